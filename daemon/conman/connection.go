@@ -137,6 +137,11 @@ func newConnectionImpl(nfp *netfilter.Packet, c *Connection, protoType string) (
 		c.Process = procmon.NewProcess(pid, "")
 		return c, nil
 	}
+	if c.DstHost == "" {
+		// in lazy mode, resolve it for the next connections, but not the
+		// ones of the daemon: they may be the lookups themselves.
+		dns.LookupLater(c.DstIP)
+	}
 
 	if c.Process = procmon.FindProcess(pid, showUnknownCons); c.Process == nil {
 		return nil, fmt.Errorf("Could not find process by its pid %d for: %s", pid, c)
@@ -161,6 +166,7 @@ func NewConnection(nfp *netfilter.Packet) (c *Connection, err error) {
 		DstHost: dns.HostOr(ip.DstIP, ""),
 		pkt:     nfp,
 	}
+	dns.CountConnection(ip.DstIP.String())
 	return newConnectionImpl(nfp, c, "")
 }
 
@@ -180,6 +186,7 @@ func NewConnection6(nfp *netfilter.Packet) (c *Connection, err error) {
 		DstHost: dns.HostOr(ip.DstIP, ""),
 		pkt:     nfp,
 	}
+	dns.CountConnection(ip.DstIP.String())
 	return newConnectionImpl(nfp, c, "6")
 }
 
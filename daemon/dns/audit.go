@@ -0,0 +1,134 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+)
+
+// DefaultAuditFiles is the number of rotated audit files kept by default.
+const DefaultAuditFiles = 5
+
+// AuditOptions holds the options of the DNS audit file.
+type AuditOptions struct {
+	// Path of the audit file.
+	Path string
+	// MaxSize is the size in bytes after which the file is rotated. If 0, it's
+	// never rotated.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept: Path.1 is the most recent
+	// one. If 0, DefaultAuditFiles are kept.
+	MaxFiles int
+	// Sync flushes every record to disk, at the cost of some performance.
+	Sync bool
+}
+
+// Audit appends the tracked records to a file, one JSON object per line,
+// until the context is cancelled.
+// As Persist(), the records are queued up to queueSize and written from a
+// different goroutine, so a slow disk never blocks the tracking. The records
+// discarded are counted in the DroppedEvents stat.
+func Audit(ctx context.Context, opts AuditOptions, queueSize int) error {
+	w := &auditWriter{opts: opts}
+	if w.opts.MaxFiles <= 0 {
+		w.opts.MaxFiles = DefaultAuditFiles
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	log.Info("Writing DNS audit records to %s", opts.Path)
+
+	events, unsubscribe := Subscribe(queueSize)
+	go func() {
+		defer unsubscribe()
+		defer w.close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-events:
+				if err := w.write(ev); err != nil {
+					log.Warning("Error writing DNS audit record %s -> %s: %s", ev.IP, ev.Host, err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+type auditWriter struct {
+	opts AuditOptions
+	file *os.File
+	size int64
+}
+
+func (w *auditWriter) open() error {
+	f, err := os.OpenFile(w.opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = st.Size()
+	return nil
+}
+
+func (w *auditWriter) close() {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+}
+
+func (w *auditWriter) write(ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.opts.MaxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	// the file may not be open if a previous rotation failed.
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if w.opts.Sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+// rotate renames the current file to Path.1, shifting the previous ones and
+// removing the oldest, and opens a new one.
+func (w *auditWriter) rotate() error {
+	w.close()
+	path := w.opts.Path
+	os.Remove(fmt.Sprint(path, ".", w.opts.MaxFiles))
+	for i := w.opts.MaxFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprint(path, ".", i), fmt.Sprint(path, ".", i+1))
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+	return w.open()
+}
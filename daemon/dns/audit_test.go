@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	tmpDir, err := ioutil.TempDir("", "ostest_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "audit.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := Audit(ctx, AuditOptions{Path: path, Sync: true}, 16); err != nil {
+		t.Fatal("Audit() error:", err)
+	}
+	if st, err := os.Stat(path); err != nil || st.Mode().Perm() != 0600 {
+		t.Error("Audit() invalid file permissions:", st, err)
+	}
+	Track("203.0.113.60", "audit.example.com")
+
+	var ev Event
+	for i := 0; i < 100 && ev.IP == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+		data, _ := ioutil.ReadFile(path)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			if err := json.Unmarshal(data[:i], &ev); err != nil {
+				t.Fatal("Audit() invalid record:", err, string(data))
+			}
+		}
+	}
+	if ev.IP != "203.0.113.60" || ev.Host != "audit.example.com" || ev.Time.IsZero() {
+		t.Error("Audit() unexpected record:", ev)
+	}
+}
+
+func TestAuditRotation(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ostest_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "audit.log")
+
+	w := &auditWriter{opts: AuditOptions{Path: path, MaxSize: 200, MaxFiles: 2}}
+	if err := w.open(); err != nil {
+		t.Fatal("open() error:", err)
+	}
+	defer w.close()
+	for i := 0; i < 20; i++ {
+		ev := Event{IP: fmt.Sprint("203.0.113.", i), Host: "rotate.example.com", Time: time.Now()}
+		if err := w.write(ev); err != nil {
+			t.Fatal("write() error:", err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		st, err := os.Stat(p)
+		if err != nil {
+			t.Error("write() file not rotated:", p, err)
+		} else if st.Size() > 200 {
+			t.Error("write() file bigger than the maximum size:", p, st.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("write() kept more rotated files than the maximum:", err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if !bytes.Contains(data, []byte(`"ip":"203.0.113.19"`)) {
+		t.Error("write() last record not in the current file:", string(data))
+	}
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+	"github.com/evilsocket/opensnitch/daemon/netstat"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Bootstrap tracks the domains of the connections established before the
+// daemon started, since the applications won't resolve them again.
+// Domains are obtained with reverse lookups (which also look up /etc/hosts),
+// at most one every interval, until all the IPs are resolved or the context is
+// cancelled.
+func Bootstrap(ctx context.Context, interval time.Duration) {
+	var entries []netstat.Entry
+	for _, proto := range []string{"tcp", "tcp6"} {
+		if list, err := netstat.Parse(proto); err == nil {
+			entries = append(entries, list...)
+		}
+	}
+	ips := remoteIPs(entries)
+	log.Info("Resolving %d IPs of connections established before the daemon started", len(ips))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	resolved := 0
+	for _, ip := range ips {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+		if err != nil || len(names) == 0 {
+			continue
+		}
+		if TrackFrom(ip, names[0], nil, layers.DNSTypePTR.String()) != TrackSkipped {
+			resolved++
+		}
+	}
+	log.Info("%d IPs of established connections resolved", resolved)
+}
+
+// remoteIPs returns the unique remote IPs of the connections, not tracked yet.
+func remoteIPs(entries []netstat.Entry) (ips []string) {
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.DstIP == nil || e.DstIP.IsUnspecified() || e.DstIP.IsLoopback() {
+			continue
+		}
+		ip := e.DstIP.String()
+		if seen[ip] {
+			continue
+		}
+		seen[ip] = true
+		if _, found := Host(ip); !found {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
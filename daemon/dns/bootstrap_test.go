@@ -0,0 +1,27 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/evilsocket/opensnitch/daemon/netstat"
+)
+
+func TestBootstrapRemoteIPs(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	Track("192.0.2.230", "tracked.example.com")
+	entries := []netstat.Entry{
+		// listening socket
+		netstat.NewEntry("tcp", net.ParseIP("0.0.0.0"), 22, net.ParseIP("0.0.0.0"), 0, 0, 1),
+		netstat.NewEntry("tcp", net.ParseIP("127.0.0.1"), 40000, net.ParseIP("127.0.0.1"), 631, 0, 2),
+		netstat.NewEntry("tcp", net.ParseIP("192.168.1.100"), 40001, net.ParseIP("192.0.2.230"), 443, 0, 3),
+		netstat.NewEntry("tcp", net.ParseIP("192.168.1.100"), 40002, net.ParseIP("192.0.2.231"), 443, 0, 4),
+		netstat.NewEntry("tcp", net.ParseIP("192.168.1.100"), 40003, net.ParseIP("192.0.2.231"), 443, 0, 5),
+	}
+
+	ips := remoteIPs(entries)
+	if len(ips) != 1 || ips[0] != "192.0.2.231" {
+		t.Error("remoteIPs() unexpected IPs:", ips)
+	}
+}
@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of mapping changes.
+const (
+	// ChangeHost means that the domain of an IP changed.
+	ChangeHost = "host"
+	// ChangeIPs means that a domain was resolved to a new IP.
+	ChangeIPs = "ips"
+)
+
+// ChangeEvent holds a change of the mapping between IPs and domains.
+type ChangeEvent struct {
+	Kind string `json:"kind"`
+	// IP is the IP whose domain changed, or the new IP of the domain.
+	IP string `json:"ip"`
+	// Host is the domain whose IPs changed.
+	Host    string    `json:"host,omitempty"`
+	OldHost string    `json:"old_host,omitempty"`
+	NewHost string    `json:"new_host,omitempty"`
+	OldIPs  []string  `json:"old_ips,omitempty"`
+	NewIPs  []string  `json:"new_ips,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+var (
+	changeSubscribers = make(map[chan ChangeEvent]bool)
+	changeSubsLock    = sync.RWMutex{}
+	// changeSubsCount avoids checking the changes if nobody is watching them.
+	changeSubsCount int32
+)
+
+// SubscribeChanges returns a channel where only the changes of the mapping
+// between IPs and domains are sent, and a function to unsubscribe from it:
+// an IP resolved to a different domain, or a domain resolved to a new IP.
+// As Subscribe(), tracking never blocks on subscribers: events are discarded
+// if the channel buffer is full.
+func SubscribeChanges(size int) (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, size)
+
+	changeSubsLock.Lock()
+	changeSubscribers[ch] = true
+	atomic.AddInt32(&changeSubsCount, 1)
+	changeSubsLock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			changeSubsLock.Lock()
+			delete(changeSubscribers, ch)
+			atomic.AddInt32(&changeSubsCount, -1)
+			changeSubsLock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func watchingChanges() bool {
+	return atomic.LoadInt32(&changeSubsCount) > 0
+}
+
+func publishChange(ev ChangeEvent) {
+	changeSubsLock.RLock()
+	defer changeSubsLock.RUnlock()
+
+	for ch := range changeSubscribers {
+		select {
+		case ch <- ev:
+		default:
+			atomic.AddUint64(&droppedEvents, 1)
+		}
+	}
+}
+
+// ipsChange returns the change of the IPs of a domain, if it's resolved to an
+// IP it wasn't resolved to. Domains resolved for the first time are not a
+// change.
+// It must be called before indexing the IP.
+func ipsChange(resolved, hostname string, now time.Time) (ev ChangeEvent, changed bool) {
+	if net.ParseIP(resolved) == nil {
+		return ev, false
+	}
+	ips := indexed(hostname)
+	if contains(ips, resolved) {
+		return ev, false
+	}
+	var old []string
+	for _, ip := range ips {
+		if _, found := alive(ip, now); found && net.ParseIP(ip) != nil {
+			old = append(old, ip)
+		}
+	}
+	if len(old) == 0 {
+		return ev, false
+	}
+	sort.Strings(old)
+	return ChangeEvent{
+		Kind:   ChangeIPs,
+		IP:     resolved,
+		Host:   hostname,
+		OldIPs: old,
+		NewIPs: append(append([]string{}, old...), resolved),
+		Time:   now,
+	}, true
+}
@@ -0,0 +1,37 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestSubscribeChanges(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	changes, unsubscribe := SubscribeChanges(8)
+	defer unsubscribe()
+
+	Track("198.51.100.160", "first.changes.example.com")
+	Track("198.51.100.160", "first.changes.example.com")
+	Track("198.51.100.160", "second.changes.example.com")
+	Track("198.51.100.161", "second.changes.example.com")
+
+	if n := len(changes); n != 2 {
+		t.Fatal("SubscribeChanges() unexpected number of changes:", n)
+	}
+	ev := <-changes
+	if ev.Kind != ChangeHost || ev.IP != "198.51.100.160" || ev.OldHost != "first.changes.example.com" || ev.NewHost != "second.changes.example.com" {
+		t.Error("SubscribeChanges() unexpected host change:", ev)
+	}
+	ev = <-changes
+	if ev.Kind != ChangeIPs || ev.Host != "second.changes.example.com" || len(ev.OldIPs) != 1 || len(ev.NewIPs) != 2 || ev.NewIPs[1] != "198.51.100.161" {
+		t.Error("SubscribeChanges() unexpected IPs change:", ev)
+	}
+
+	unsubscribe()
+	if watchingChanges() {
+		t.Error("SubscribeChanges() changes still watched after unsubscribing")
+	}
+	if _, ok := <-changes; ok {
+		t.Error("SubscribeChanges() channel not closed")
+	}
+}
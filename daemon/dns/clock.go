@@ -0,0 +1,32 @@
+package dns
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Monotonic returns the current time of the monotonic clock, in nanoseconds
+// since boot (CLOCK_MONOTONIC). It's the clock used by bpf_ktime_get_ns(), so
+// timestamps taken by eBPF programs can be compared with it.
+func Monotonic() uint64 {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0
+	}
+	return uint64(ts.Nano())
+}
+
+// BootTime returns the wall time when the monotonic clock started.
+// It's calculated on every call, because the wall clock may be adjusted.
+func BootTime() time.Time {
+	now := time.Now()
+	return now.Add(-time.Duration(Monotonic())).Round(time.Microsecond)
+}
+
+// MonotonicToWall converts a timestamp of the monotonic clock (nanoseconds
+// since boot) to wall time, in order to correlate the DNS records with the
+// events of other sources, like the connections.
+func MonotonicToWall(ns uint64) time.Time {
+	return BootTime().Add(time.Duration(ns))
+}
@@ -0,0 +1,19 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonotonicToWall(t *testing.T) {
+	if boot := BootTime(); boot.After(time.Now()) || boot.IsZero() {
+		t.Error("BootTime() invalid:", boot)
+	}
+	if diff := time.Since(MonotonicToWall(Monotonic())); diff < -time.Millisecond || diff > time.Millisecond {
+		t.Error("MonotonicToWall() not aligned with the wall clock:", diff)
+	}
+	ns := Monotonic()
+	if d := MonotonicToWall(ns + uint64(time.Second)).Sub(MonotonicToWall(ns)); d < time.Second-time.Millisecond || d > time.Second+time.Millisecond {
+		t.Error("MonotonicToWall() unexpected interval:", d)
+	}
+}
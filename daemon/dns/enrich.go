@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"context"
+	"net"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+)
+
+// GeoInfo holds the location and network owner of an IP.
+type GeoInfo struct {
+	Country string `json:"country,omitempty"`
+	ASN     uint32 `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+}
+
+// GeoResolver obtains the GeoIP/ASN information of an IP, from a database
+// provided by the user for example.
+type GeoResolver interface {
+	Lookup(ip net.IP) (GeoInfo, error)
+}
+
+// Enrich looks up the GeoIP/ASN information of the tracked IPs with a
+// resolver, until the context is cancelled.
+// As Persist(), the IPs are queued up to queueSize and looked up from a
+// different goroutine, so the tracking is never blocked. IPs are only looked
+// up once, while they stay in the list.
+func Enrich(ctx context.Context, resolver GeoResolver, queueSize int) {
+	events, unsubscribe := Subscribe(queueSize)
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-events:
+				enrich(resolver, ev.IP)
+			}
+		}
+	}()
+}
+
+func enrich(resolver GeoResolver, resolved string) {
+	ip := net.ParseIP(resolved)
+	if ip == nil {
+		return
+	}
+	if _, found := GetGeoInfo(resolved); found {
+		return
+	}
+	info, err := resolver.Lookup(ip)
+	if err != nil {
+		log.Debug("Error looking up GeoIP information of %s: %s", resolved, err)
+		return
+	}
+
+	s := getShard(resolved)
+	s.Lock()
+	defer s.Unlock()
+	if e, found := s.entries[resolved]; found {
+		e.geo = &info
+	}
+}
+
+// GetGeoInfo returns the GeoIP/ASN information of a tracked IP, if it has been
+// looked up.
+func GetGeoInfo(resolved string) (info GeoInfo, found bool) {
+	s := getShard(resolved)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[resolved]
+	if !found || e.geo == nil {
+		return GeoInfo{}, false
+	}
+	return *e.geo, true
+}
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testGeoResolver struct {
+	lookups int32
+}
+
+func (r *testGeoResolver) Lookup(ip net.IP) (GeoInfo, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	if ip.Equal(net.ParseIP("198.51.100.141")) {
+		return GeoInfo{}, errors.New("not found")
+	}
+	return GeoInfo{Country: "ZZ", ASN: 64496, Org: "Example"}, nil
+}
+
+func TestEnrich(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resolver := &testGeoResolver{}
+	Enrich(ctx, resolver, 8)
+
+	Track("198.51.100.140", "geo.example.com")
+	Track("198.51.100.141", "nogeo.example.com")
+	Track("cname.geo.example.net", "alias.geo.example.com")
+
+	var info GeoInfo
+	var found bool
+	for i := 0; i < 100 && !found; i++ {
+		time.Sleep(10 * time.Millisecond)
+		info, found = GetGeoInfo("198.51.100.140")
+	}
+	if !found || info.ASN != 64496 || info.Country != "ZZ" {
+		t.Fatal("Enrich() IP not enriched:", info, found)
+	}
+	if e, _ := GetEntry("198.51.100.140"); e.Geo == nil || e.Geo.Org != "Example" {
+		t.Error("GetEntry() GeoIP information not exported:", e)
+	}
+	if _, found := GetGeoInfo("198.51.100.141"); found {
+		t.Error("GetGeoInfo() failed lookup stored")
+	}
+
+	Track("198.51.100.140", "geo.example.com")
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&resolver.lookups); n != 2 {
+		t.Error("Enrich() unexpected number of lookups:", n)
+	}
+}
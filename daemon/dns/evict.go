@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	evictCallbacks []func(ip, host string)
+	pinCheck       func(ip string, hosts []string) bool
+	evictLock      = sync.RWMutex{}
+
+	// PinGracePeriod is the time an entry is kept after expiring, while it's
+	// pinned.
+	PinGracePeriod = 24 * time.Hour
+)
+
+// OnEvict registers a function to be called for every domain removed from the
+// list, either because it expired, because its IP exceeded MaxHostsPerIP, or
+// because it was removed with ForgetIP().
+// Callbacks are called without holding the list lock, so they can query it.
+func OnEvict(cb func(ip, host string)) {
+	evictLock.Lock()
+	defer evictLock.Unlock()
+
+	evictCallbacks = append(evictCallbacks, cb)
+}
+
+// SetPinCheck registers a function that reports if an entry about to expire is
+// pinned, usually because its domains are referenced by a rule. Pinned entries
+// are kept up to PinGracePeriod after expiring, for the services that don't
+// resolve their domains often.
+// The domains include the ones the entry is an alias of (CNAMEs).
+// The function is called without holding the list lock, so it can query it.
+func SetPinCheck(cb func(ip string, hosts []string) bool) {
+	evictLock.Lock()
+	defer evictLock.Unlock()
+
+	pinCheck = cb
+}
+
+// pinnedEntries returns the entries that will be expired at the given time,
+// and are pinned.
+func pinnedEntries(at time.Time) map[string]bool {
+	pinned := make(map[string]bool)
+	evictLock.RLock()
+	cb := pinCheck
+	evictLock.RUnlock()
+	if cb == nil {
+		return pinned
+	}
+
+	candidates := make(map[string][]string)
+	forEachEntry(func(resolved string, e *entry) {
+		if e.expired(at) {
+			candidates[resolved] = append([]string{}, e.hosts...)
+		}
+	})
+
+	for resolved, hosts := range candidates {
+		if cb(resolved, aliasesOf(hosts)) {
+			pinned[resolved] = true
+		}
+	}
+	return pinned
+}
+
+// aliasesOf returns the domains of an entry, and the ones they're aliases of,
+// whether they've expired or not.
+func aliasesOf(pending []string) []string {
+	hosts := make([]string, 0, len(pending))
+	seen := make(map[string]bool)
+	for len(pending) > 0 {
+		h := pending[0]
+		pending = pending[1:]
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		hosts = append(hosts, h)
+
+		s := getShard(h)
+		s.RLock()
+		if alias, found := s.entries[h]; found && alias.source != layers.DNSTypeSRV.String() && alias.source != layers.DNSTypeMX.String() {
+			pending = append(pending, alias.hosts...)
+		}
+		s.RUnlock()
+	}
+	return hosts
+}
+
+// ForgetIP removes an IP and its domains from the list.
+func ForgetIP(resolved string) {
+	notifyEvicted(resolved, removeEntry(resolved)...)
+}
+
+// removeEntry removes an IP from the list without notifying it, and returns
+// its domains.
+func removeEntry(resolved string) []string {
+	s := getShard(resolved)
+	s.Lock()
+	defer s.Unlock()
+
+	e, found := s.entries[resolved]
+	if !found {
+		return nil
+	}
+	delete(s.entries, resolved)
+	unindex(resolved, e.hosts...)
+	return e.hosts
+}
+
+func notifyEvicted(resolved string, hosts ...string) {
+	if len(hosts) == 0 {
+		return
+	}
+	evictLock.RLock()
+	defer evictLock.RUnlock()
+
+	for _, cb := range evictCallbacks {
+		for _, host := range hosts {
+			cb(resolved, host)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package dns
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOnEvict(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	var mu sync.Mutex
+	evicted := make(map[string]string)
+	OnEvict(func(ip, host string) {
+		mu.Lock()
+		evicted[host] = ip
+		mu.Unlock()
+	})
+	isEvicted := func(host, ip string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return evicted[host] == ip
+	}
+
+	t.Run("Test ForgetIP", func(t *testing.T) {
+		Track("198.51.100.1", "forget.example.com")
+		ForgetIP("198.51.100.1")
+		if _, found := Host("198.51.100.1"); found {
+			t.Error("ForgetIP() IP not removed")
+		}
+		if !isEvicted("forget.example.com", "198.51.100.1") {
+			t.Error("OnEvict() not called on ForgetIP()")
+		}
+	})
+
+	t.Run("Test MaxHostsPerIP", func(t *testing.T) {
+		oldMax := MaxHostsPerIP
+		MaxHostsPerIP = 1
+		defer func() { MaxHostsPerIP = oldMax }()
+
+		Track("198.51.100.2", "old.example.com")
+		Track("198.51.100.2", "new.example.com")
+		if !isEvicted("old.example.com", "198.51.100.2") {
+			t.Error("OnEvict() not called when exceeding MaxHostsPerIP")
+		}
+	})
+
+	t.Run("Test expired", func(t *testing.T) {
+		Track("198.51.100.3", "expired.example.com")
+		setLastSeen("198.51.100.3", time.Now().Add(-MaxEntryAge-time.Second))
+		cleanup(time.Minute)
+		if !isEvicted("expired.example.com", "198.51.100.3") {
+			t.Error("OnEvict() not called on cleanup()")
+		}
+	})
+
+	evictLock.Lock()
+	evictCallbacks = nil
+	evictLock.Unlock()
+}
+
+func TestPinCheck(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	SetPinCheck(func(ip string, hosts []string) bool {
+		return contains(hosts, "pinned.example.com")
+	})
+	defer SetPinCheck(nil)
+
+	Track("198.51.100.120", "pinned.example.com")
+	Track("198.51.100.121", "unpinned.example.com")
+	Track("cdn.pinned.example.net", "pinned.example.com")
+	Track("198.51.100.122", "cdn.pinned.example.net")
+	Track("198.51.100.123", "pinned.example.com")
+	for _, ip := range []string{"198.51.100.120", "198.51.100.121", "cdn.pinned.example.net", "198.51.100.122"} {
+		setLastSeen(ip, time.Now().Add(-MaxEntryAge-time.Second))
+	}
+	setLastSeen("198.51.100.123", time.Now().Add(-MaxEntryAge-PinGracePeriod-time.Second))
+	cleanup(time.Minute)
+
+	for _, ip := range []string{"198.51.100.120", "cdn.pinned.example.net", "198.51.100.122"} {
+		if _, found := Host(ip); !found {
+			t.Error("cleanup() pinned entry evicted:", ip)
+		}
+	}
+	if _, found := Host("198.51.100.121"); found {
+		t.Error("cleanup() unpinned entry not evicted")
+	}
+	if _, found := Host("198.51.100.123"); found {
+		t.Error("cleanup() pinned entry not evicted after the grace period")
+	}
+
+	t.Run("Test about to expire", func(t *testing.T) {
+		Track("198.51.100.124", "pinned.example.com")
+		setLastSeen("198.51.100.124", time.Now().Add(-MaxEntryAge+time.Second))
+		cleanup(time.Minute)
+		s := getShard("198.51.100.124")
+		s.RLock()
+		until := s.entries["198.51.100.124"].pinnedUntil
+		s.RUnlock()
+		if until.IsZero() {
+			t.Error("cleanup() entry about to expire not pinned")
+		}
+	})
+}
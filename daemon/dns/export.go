@@ -0,0 +1,39 @@
+package dns
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportHostsFormat writes the tracked IPs in the hosts file format:
+// 192.0.2.1 most-recent.example.com other.example.com
+// Entries not seen in the last maxAge are excluded, if maxAge is not 0.
+// CNAMEs are not exported, because they're not IPs.
+func ExportHostsFormat(w io.Writer, maxAge time.Duration) error {
+	now := time.Now()
+	var lines []string
+	for resolved, e := range Snapshot() {
+		if net.ParseIP(resolved) == nil {
+			continue
+		}
+		if maxAge > 0 && now.Sub(e.LastSeen) > maxAge {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\n", resolved, strings.Join(e.Hosts, " ")))
+	}
+	sort.Strings(lines)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %d IPs exported by opensnitch on %s\n", len(lines), now.Format(time.RFC3339))
+	for _, line := range lines {
+		if _, err := bw.WriteString(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
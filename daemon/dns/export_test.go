@@ -0,0 +1,42 @@
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHostsFormat(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	Track("198.51.100.50", "b.export.example.com")
+	Track("198.51.100.50", "a.export.example.com")
+	Track("2001:db8::50", "v6.export.example.com")
+	Track("cname.export.example.com", "alias.export.example.com")
+	Track("198.51.100.51", "stale.export.example.com")
+	setLastSeen("198.51.100.51", time.Now().Add(-2*time.Hour))
+
+	var buf bytes.Buffer
+	if err := ExportHostsFormat(&buf, time.Hour); err != nil {
+		t.Fatal("ExportHostsFormat() error:", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "198.51.100.50\ta.export.example.com b.export.example.com\n") {
+		t.Error("ExportHostsFormat() IPv4 entry not exported:", out)
+	}
+	if !strings.Contains(out, "2001:db8::50\tv6.export.example.com\n") {
+		t.Error("ExportHostsFormat() IPv6 entry not exported:", out)
+	}
+	if strings.Contains(out, "alias.export.example.com") {
+		t.Error("ExportHostsFormat() CNAME exported:", out)
+	}
+	if strings.Contains(out, "stale.export.example.com") {
+		t.Error("ExportHostsFormat() stale entry exported:", out)
+	}
+
+	hosts, err := parseHostsFileFrom(strings.NewReader(out))
+	if err != nil || len(hosts["198.51.100.50"]) != 2 {
+		t.Error("ExportHostsFormat() output can't be parsed as a hosts file:", hosts, err)
+	}
+}
@@ -0,0 +1,441 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Address families that can be tracked.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// Policies for DNS rebinding attempts: domains that used to resolve to public
+// IPs now resolving to private or loopback ones.
+const (
+	// RebindingAlert tracks the domain, flagging its event. It's the default.
+	RebindingAlert = "alert"
+	// RebindingDrop doesn't track the domain for the private IP.
+	RebindingDrop = "drop"
+	// RebindingIgnore doesn't check them.
+	RebindingIgnore = "ignore"
+)
+
+// Policies for the domains longer than the maximum length.
+const (
+	// LongHostReject doesn't track them. It's the default.
+	LongHostReject = "reject"
+	// LongHostTruncate tracks the rightmost labels that fit, if there's more
+	// than one: a.b.example.com -> b.example.com
+	LongHostTruncate = "truncate"
+)
+
+// Scopes of the addresses that are not globally routable unicast ones.
+// Private IPv4 addresses have no scope: as the unique local ones by default,
+// they're tracked.
+const (
+	ScopeLoopback      = "loopback"
+	ScopeLinkLocal     = "link-local"
+	ScopeULA           = "ula"
+	ScopeMulticast     = "multicast"
+	ScopeDocumentation = "documentation"
+	// ScopeNone is used to skip no scope at all.
+	ScopeNone = "none"
+)
+
+// DefaultSkip are the scopes not tracked by default: only routable unicast
+// addresses are tracked, including the private and unique local ones of the
+// local network.
+var DefaultSkip = []string{ScopeLoopback, ScopeLinkLocal, ScopeMulticast, ScopeDocumentation}
+
+// MaxHostLength is the maximum length of a domain name.
+const MaxHostLength = 253
+
+// Filter holds the options to select which DNS records are tracked.
+type Filter struct {
+	// TrackLocal enables tracking the domains resolved to loopback and
+	// link-local addresses, even if they're in Skip.
+	TrackLocal bool `json:"TrackLocal"`
+	// Skip are the scopes of the addresses not to track: loopback,
+	// link-local, ula, multicast and documentation, or none. If empty,
+	// DefaultSkip is used.
+	Skip []string `json:"Skip"`
+	// Allow are regular expressions of the domains to track. If empty, all
+	// the domains are tracked.
+	Allow []string `json:"Allow"`
+	// Suppress are regular expressions of the domains not to track.
+	Suppress []string `json:"Suppress"`
+	// Exclude are domains never to be tracked, along with their subdomains,
+	// for privacy: example.com excludes example.com and www.example.com.
+	// The domains they're aliases of are not tracked either.
+	Exclude []string `json:"Exclude"`
+	// Families are the address families to track. If empty, all of them are
+	// tracked.
+	Families []string `json:"Families"`
+	// SampleRate, if greater than 1, delivers to the subscribers only 1 of
+	// every SampleRate refreshed records, to limit the overhead on hosts with
+	// lots of resolutions. New and changed records are always delivered, and
+	// the list is always updated.
+	SampleRate uint64 `json:"SampleRate"`
+	// Rebinding is the policy for DNS rebinding attempts: alert, drop or
+	// ignore. Attempts are always logged and counted, unless ignored.
+	Rebinding string `json:"Rebinding"`
+	// MaxHostLength is the maximum length of the domains tracked, up to
+	// MaxHostLength, which is the default.
+	MaxHostLength int `json:"MaxHostLength"`
+	// LongHosts is the policy for the domains longer than MaxHostLength:
+	// reject or truncate. They're always counted.
+	LongHosts string `json:"LongHosts"`
+
+	allow    []*regexp.Regexp
+	suppress []*regexp.Regexp
+	exclude  []string
+	skip     map[string]bool
+	ipv4     bool
+	ipv6     bool
+}
+
+// current filter, swapped atomically so the tracker never sees a half-updated
+// one.
+var filter atomic.Value
+
+// filter the DNS section of the configuration is applied on.
+var defaultFilter atomic.Value
+
+func init() {
+	f := &Filter{}
+	f.compile()
+	filter.Store(f)
+	defaultFilter.Store(Filter{})
+}
+
+// SetFilter validates and applies a new filter.
+// If it's not valid, the current one is kept.
+// The IPs of the domains excluded by the new filter are removed from the list.
+func SetFilter(f Filter) error {
+	if err := f.compile(); err != nil {
+		return err
+	}
+	filter.Store(&f)
+	f.forgetExcluded()
+	return nil
+}
+
+// SetDefaultFilter validates and applies the filter given on the command
+// line. The DNS section of the configuration is applied on top of it, so it
+// only overrides the options it sets.
+func SetDefaultFilter(f Filter) error {
+	if err := SetFilter(f); err != nil {
+		return err
+	}
+	defaultFilter.Store(f.clone())
+	return nil
+}
+
+// GetDefaultFilter returns the filter given on the command line.
+func GetDefaultFilter() Filter {
+	return defaultFilter.Load().(Filter).clone()
+}
+
+// clone returns a copy of the options of a filter that doesn't share their
+// lists, so they can be decoded on without modifying the original ones.
+func (f Filter) clone() Filter {
+	c := f
+	c.Allow = append([]string(nil), f.Allow...)
+	c.Suppress = append([]string(nil), f.Suppress...)
+	c.Exclude = append([]string(nil), f.Exclude...)
+	c.Families = append([]string(nil), f.Families...)
+	c.Skip = append([]string(nil), f.Skip...)
+	return c
+}
+
+// GetFilter returns the current filter.
+func GetFilter() Filter {
+	return *filter.Load().(*Filter)
+}
+
+func getFilter() *Filter {
+	return filter.Load().(*Filter)
+}
+
+func (f *Filter) compile() error {
+	allow, err := compilePatterns(f.Allow)
+	if err != nil {
+		return fmt.Errorf("Invalid DNS allow pattern: %s", err)
+	}
+	suppress, err := compilePatterns(f.Suppress)
+	if err != nil {
+		return fmt.Errorf("Invalid DNS suppress pattern: %s", err)
+	}
+	exclude := make([]string, 0, len(f.Exclude))
+	for _, domain := range f.Exclude {
+		if domain = NormalizeHost(strings.TrimPrefix(domain, "*.")); domain != "" {
+			exclude = append(exclude, domain)
+		}
+	}
+	skip, err := compileScopes(f.Skip)
+	if err != nil {
+		return err
+	}
+	if f.TrackLocal {
+		delete(skip, ScopeLoopback)
+		delete(skip, ScopeLinkLocal)
+	}
+	ipv4 := len(f.Families) == 0
+	ipv6 := len(f.Families) == 0
+	for _, family := range f.Families {
+		switch family {
+		case FamilyIPv4:
+			ipv4 = true
+		case FamilyIPv6:
+			ipv6 = true
+		default:
+			return fmt.Errorf("Invalid DNS address family: %s, expected %s or %s", family, FamilyIPv4, FamilyIPv6)
+		}
+	}
+
+	switch f.Rebinding {
+	case "", RebindingAlert, RebindingDrop, RebindingIgnore:
+	default:
+		return fmt.Errorf("Invalid DNS rebinding policy: %s, expected %s, %s or %s", f.Rebinding, RebindingAlert, RebindingDrop, RebindingIgnore)
+	}
+
+	if f.MaxHostLength < 0 || f.MaxHostLength > MaxHostLength {
+		return fmt.Errorf("Invalid DNS maximum domain length: %d, expected up to %d", f.MaxHostLength, MaxHostLength)
+	}
+	switch f.LongHosts {
+	case "", LongHostReject, LongHostTruncate:
+	default:
+		return fmt.Errorf("Invalid DNS long domains policy: %s, expected %s or %s", f.LongHosts, LongHostReject, LongHostTruncate)
+	}
+
+	f.allow = allow
+	f.suppress = suppress
+	f.exclude = exclude
+	f.skip = skip
+	f.ipv4 = ipv4
+	f.ipv6 = ipv6
+	return nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func compileScopes(scopes []string) (map[string]bool, error) {
+	if len(scopes) == 0 {
+		scopes = DefaultSkip
+	}
+	skip := make(map[string]bool)
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeNone:
+		case ScopeLoopback, ScopeLinkLocal, ScopeULA, ScopeMulticast, ScopeDocumentation:
+			skip[scope] = true
+		default:
+			return nil, fmt.Errorf("Invalid DNS address scope: %s, expected %s, %s, %s, %s, %s or %s", scope,
+				ScopeLoopback, ScopeLinkLocal, ScopeULA, ScopeMulticast, ScopeDocumentation, ScopeNone)
+		}
+	}
+	return skip, nil
+}
+
+// acceptIP checks if the domains of an address must be tracked.
+// Resolved values that are not IPs (CNAMEs) are only checked against the
+// excluded domains.
+func (f *Filter) acceptIP(resolved string) bool {
+	ip := net.ParseIP(resolved)
+	if ip == nil {
+		if f.excluded(resolved) {
+			atomic.AddUint64(&excluded, 1)
+			return false
+		}
+		return true
+	}
+	if f.skip[Scope(ip)] {
+		atomic.AddUint64(&skippedLocal, 1)
+		return false
+	}
+	if (ip.To4() != nil && !f.ipv4) || (ip.To4() == nil && !f.ipv6) {
+		atomic.AddUint64(&filtered, 1)
+		return false
+	}
+	return true
+}
+
+// limitHost applies the maximum length to a normalized domain. It returns an
+// empty domain if it's rejected.
+func (f *Filter) limitHost(hostname string) string {
+	max := f.MaxHostLength
+	if max == 0 {
+		max = MaxHostLength
+	}
+	if len(hostname) <= max {
+		return hostname
+	}
+	atomic.AddUint64(&longHosts, 1)
+	if f.LongHosts != LongHostTruncate {
+		return ""
+	}
+	for len(hostname) > max {
+		i := strings.IndexByte(hostname, '.')
+		if i < 0 {
+			return ""
+		}
+		hostname = hostname[i+1:]
+	}
+	// a top level domain alone is meaningless.
+	if strings.IndexByte(hostname, '.') < 0 {
+		return ""
+	}
+	return hostname
+}
+
+// acceptHost checks if a domain must be tracked.
+func (f *Filter) acceptHost(hostname string) bool {
+	if f.excluded(hostname) {
+		atomic.AddUint64(&excluded, 1)
+		return false
+	}
+	if f.matchHost(hostname) {
+		return true
+	}
+	atomic.AddUint64(&filtered, 1)
+	return false
+}
+
+func (f *Filter) matchHost(hostname string) bool {
+	if f.excluded(hostname) {
+		return false
+	}
+	for _, re := range f.suppress {
+		if re.MatchString(hostname) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, re := range f.allow {
+		if re.MatchString(hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded checks if a normalized domain is one of the excluded domains or a
+// subdomain of them.
+func (f *Filter) excluded(hostname string) bool {
+	for _, domain := range f.exclude {
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetExcluded removes the IPs tracked before their domains were excluded.
+func (f *Filter) forgetExcluded() {
+	if len(f.exclude) == 0 {
+		return
+	}
+	var forget []string
+	forEachEntry(func(resolved string, e *entry) {
+		if f.excluded(resolved) {
+			forget = append(forget, resolved)
+			return
+		}
+		for _, h := range e.hosts {
+			if f.excluded(h) {
+				forget = append(forget, resolved)
+				return
+			}
+		}
+	})
+
+	for _, resolved := range forget {
+		ForgetIP(resolved)
+	}
+}
+
+// Sampled returns if the events of refreshed records are being sampled.
+func Sampled() bool {
+	return getFilter().SampleRate > 1
+}
+
+// sampleOut checks if the event of a refreshed record must be discarded.
+func (f *Filter) sampleOut() bool {
+	if f.SampleRate <= 1 || atomic.AddUint64(&sampleCount, 1)%f.SampleRate == 0 {
+		return false
+	}
+	atomic.AddUint64(&sampledOut, 1)
+	return true
+}
+
+// privateNets are the networks not reachable from the internet.
+var privateNets = parseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.168.0.0/16", "::/128", "::1/128", "fc00::/7", "fe80::/10",
+)
+
+func parseCIDRs(cidrs ...string) (nets []*net.IPNet) {
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isPrivate checks if an IP is a loopback or a private address.
+func isPrivate(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentationNets are the networks reserved for documentation and examples.
+var documentationNets = parseCIDRs("192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32")
+
+var ulaNet = parseCIDRs("fc00::/7")[0]
+
+// Scope returns the scope of an IP, or an empty string if it's a routable
+// unicast address.
+// It's the only place where the tracker decides which addresses are not
+// routable.
+func Scope(ip net.IP) string {
+	switch {
+	case ip.IsMulticast():
+		return ScopeMulticast
+	case ip.IsLoopback():
+		return ScopeLoopback
+	case ip.IsLinkLocalUnicast():
+		return ScopeLinkLocal
+	case ulaNet.Contains(ip):
+		return ScopeULA
+	}
+	for _, n := range documentationNets {
+		if n.Contains(ip) {
+			return ScopeDocumentation
+		}
+	}
+	return ""
+}
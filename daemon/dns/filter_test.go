@@ -0,0 +1,271 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+// testSkip are the scopes skipped by the tests, which track documentation
+// addresses, as examples should.
+var testSkip = []string{ScopeLoopback, ScopeLinkLocal, ScopeMulticast}
+
+func TestFilter(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+
+	t.Run("Test invalid filters", func(t *testing.T) {
+		if err := SetFilter(Filter{Suppress: []string{"(invalid"}}); err == nil {
+			t.Error("SetFilter() invalid pattern accepted")
+		}
+		if err := SetFilter(Filter{Families: []string{"ipx"}}); err == nil {
+			t.Error("SetFilter() invalid family accepted")
+		}
+		if f := GetFilter(); len(f.Suppress) != 0 || len(f.Families) != 0 {
+			t.Error("SetFilter() invalid filter applied:", f)
+		}
+	})
+
+	t.Run("Test suppress", func(t *testing.T) {
+		if err := SetFilter(Filter{Skip: testSkip, Suppress: []string{`\.tracker\.example$`}}); err != nil {
+			t.Error("SetFilter() error:", err)
+		}
+		Track("198.51.100.20", "ads.tracker.example")
+		Track("198.51.100.21", "www.example.com")
+		if _, found := Host("198.51.100.20"); found {
+			t.Error("Track() suppressed domain tracked")
+		}
+		if _, found := Host("198.51.100.21"); !found {
+			t.Error("Track() not suppressed domain not tracked")
+		}
+	})
+
+	t.Run("Test allow", func(t *testing.T) {
+		if err := SetFilter(Filter{Skip: testSkip, Allow: []string{`^api\.`}}); err != nil {
+			t.Error("SetFilter() error:", err)
+		}
+		Track("198.51.100.22", "api.example.com")
+		Track("198.51.100.23", "www.example.com")
+		if _, found := Host("198.51.100.22"); !found {
+			t.Error("Track() allowed domain not tracked")
+		}
+		if _, found := Host("198.51.100.23"); found {
+			t.Error("Track() not allowed domain tracked")
+		}
+	})
+
+	t.Run("Test exclude", func(t *testing.T) {
+		Track("198.51.100.29", "old.private.example")
+		if err := SetFilter(Filter{Skip: testSkip, Exclude: []string{"Private.Example.", "*.secret.example"}}); err != nil {
+			t.Error("SetFilter() error:", err)
+		}
+		before := GetStats().Excluded
+		Track("198.51.100.25", "private.example")
+		Track("198.51.100.26", "www.PRIVATE.example.")
+		Track("198.51.100.27", "mail.secret.example")
+		Track("private.example", "alias.example.com")
+		Track("198.51.100.28", "notprivate.example")
+		for _, ip := range []string{"198.51.100.29", "198.51.100.25", "198.51.100.26", "198.51.100.27", "private.example"} {
+			if _, found := Host(ip); found {
+				t.Error("Track() excluded domain tracked:", ip)
+			}
+		}
+		if _, found := Host("198.51.100.28"); !found {
+			t.Error("Track() not excluded domain not tracked")
+		}
+		if n := GetStats().Excluded - before; n != 4 {
+			t.Error("Track() excluded domains not counted:", n)
+		}
+	})
+
+	t.Run("Test families", func(t *testing.T) {
+		if err := SetFilter(Filter{Skip: testSkip, Families: []string{FamilyIPv4}}); err != nil {
+			t.Error("SetFilter() error:", err)
+		}
+		Track("198.51.100.24", "v4.example.com")
+		Track("2001:db8::24", "v6.example.com")
+		if _, found := Host("198.51.100.24"); !found {
+			t.Error("Track() IPv4 not tracked")
+		}
+		if _, found := Host("2001:db8::24"); found {
+			t.Error("Track() IPv6 tracked")
+		}
+	})
+}
+
+func TestFilterSampleRate(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	if err := SetFilter(Filter{Skip: testSkip, SampleRate: 4}); err != nil {
+		t.Error("SetFilter() error:", err)
+	}
+	if !Sampled() || !GetStats().Sampled {
+		t.Error("Sampled() sampling mode not reported")
+	}
+
+	events, unsubscribe := Subscribe(32)
+	defer unsubscribe()
+	Track("198.51.100.30", "sampled.example.com")
+	for i := 0; i < 8; i++ {
+		Track("198.51.100.30", "sampled.example.com")
+	}
+	Track("198.51.100.30", "changed.example.com")
+
+	if n := len(events); n != 4 {
+		t.Error("Sampling, unexpected number of events:", n)
+	}
+	if host, _ := Host("198.51.100.30"); host != "changed.example.com" {
+		t.Error("Sampling, changed record not tracked:", host)
+	}
+}
+
+func TestFilterRebinding(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	if err := SetFilter(Filter{Rebinding: "block"}); err == nil {
+		t.Error("SetFilter() invalid rebinding policy accepted")
+	}
+
+	t.Run("Test alert", func(t *testing.T) {
+		events, unsubscribe := Subscribe(8)
+		defer unsubscribe()
+		before := GetStats().Rebindings
+
+		Track("192.168.10.1", "lan.rebind.example.com")
+		Track("198.51.100.31", "alert.rebind.example.com")
+		Track("192.168.10.2", "alert.rebind.example.com")
+		for i := 0; i < 3; i++ {
+			ev := <-events
+			if ev.Rebinding != (ev.IP == "192.168.10.2") {
+				t.Error("Track() unexpected rebinding flag:", ev)
+			}
+		}
+		if _, found := Host("192.168.10.2"); !found {
+			t.Error("Track() rebinding domain not tracked")
+		}
+		if n := GetStats().Rebindings - before; n != 1 {
+			t.Error("Track() rebinding attempts not counted:", n)
+		}
+	})
+
+	t.Run("Test drop", func(t *testing.T) {
+		SetFilter(Filter{Skip: testSkip, Rebinding: RebindingDrop, TrackLocal: true})
+		Track("198.51.100.32", "drop.rebind.example.com")
+		Track("127.0.0.1", "drop.rebind.example.com")
+		if h, _ := Host("127.0.0.1"); h == "drop.rebind.example.com" {
+			t.Error("Track() rebinding domain tracked")
+		}
+	})
+
+	t.Run("Test ignore", func(t *testing.T) {
+		SetFilter(Filter{Skip: testSkip, Rebinding: RebindingIgnore})
+		before := GetStats().Rebindings
+		Track("198.51.100.33", "ignore.rebind.example.com")
+		Track("10.0.0.33", "ignore.rebind.example.com")
+		if GetStats().Rebindings != before {
+			t.Error("Track() ignored rebinding attempt counted")
+		}
+	})
+}
+
+func TestFilterLongHosts(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	if err := SetFilter(Filter{MaxHostLength: 300}); err == nil {
+		t.Error("SetFilter() invalid maximum domain length accepted")
+	}
+	if err := SetFilter(Filter{LongHosts: "cut"}); err == nil {
+		t.Error("SetFilter() invalid long domains policy accepted")
+	}
+
+	t.Run("Test reject", func(t *testing.T) {
+		SetFilter(Filter{Skip: testSkip, MaxHostLength: 20})
+		before := GetStats().LongHosts
+		Track("198.51.100.150", "short.example.com")
+		Track("198.51.100.151", "a.very.long.name.example.com")
+		if _, found := Host("198.51.100.150"); !found {
+			t.Error("Track() short domain not tracked")
+		}
+		if _, found := Host("198.51.100.151"); found {
+			t.Error("Track() long domain tracked")
+		}
+		if GetStats().LongHosts != before+1 {
+			t.Error("Track() long domain not counted")
+		}
+	})
+
+	t.Run("Test truncate", func(t *testing.T) {
+		SetFilter(Filter{Skip: testSkip, MaxHostLength: 20, LongHosts: LongHostTruncate})
+		Track("198.51.100.152", "a.very.long.name.example.com")
+		if h, _ := Host("198.51.100.152"); h != "name.example.com" {
+			t.Error("Track() long domain not truncated:", h)
+		}
+		Track("198.51.100.153", "averyveryverylonglabel.com")
+		if _, found := Host("198.51.100.153"); found {
+			t.Error("Track() long label tracked")
+		}
+	})
+}
+
+func TestFilterScopes(t *testing.T) {
+	defer SetFilter(Filter{})
+
+	scopes := map[string]string{
+		"203.0.113.1": ScopeDocumentation,
+		"8.8.8.8":     "",
+		"10.0.0.1":    "",
+		"127.0.0.1":   ScopeLoopback,
+		"fe80::1":     ScopeLinkLocal,
+		"fd00::1":     ScopeULA,
+		"224.0.0.251": ScopeMulticast,
+		"ff02::1":     ScopeMulticast,
+		"2001:db8::1": ScopeDocumentation,
+	}
+	for addr, scope := range scopes {
+		if s := Scope(net.ParseIP(addr)); s != scope {
+			t.Error("Scope() invalid scope:", addr, s)
+		}
+	}
+
+	if err := SetFilter(Filter{Skip: []string{"site-local"}}); err == nil {
+		t.Error("SetFilter() invalid scope accepted")
+	}
+
+	if err := SetFilter(Filter{}); err != nil {
+		t.Error("SetFilter() error:", err)
+	}
+	Track("224.0.0.252", "mdns.example.com")
+	Track("203.0.113.2", "doc.example.com")
+	Track("8.8.4.4", "dns.example.com")
+	Track("10.0.0.2", "lan.example.com")
+	Track("fd00::2", "ula.example.com")
+	for _, ip := range []string{"224.0.0.252", "203.0.113.2"} {
+		if _, found := Host(ip); found {
+			t.Error("Track() address not routable tracked by default:", ip)
+		}
+	}
+	for _, ip := range []string{"8.8.4.4", "10.0.0.2", "fd00::2"} {
+		if _, found := Host(ip); !found {
+			t.Error("Track() routable address not tracked by default:", ip)
+		}
+	}
+
+	if err := SetFilter(Filter{Skip: []string{ScopeULA}}); err != nil {
+		t.Error("SetFilter() error:", err)
+	}
+	Track("fd00::3", "ula.example.com")
+	Track("127.0.2.1", "loopback.example.com")
+	if _, found := Host("fd00::3"); found {
+		t.Error("Track() skipped unique local address tracked")
+	}
+	if _, found := Host("127.0.2.1"); !found {
+		t.Error("Track() loopback address not tracked when not skipped")
+	}
+
+	if err := SetFilter(Filter{Skip: []string{ScopeNone}}); err != nil {
+		t.Error("SetFilter() error:", err)
+	}
+	Track("224.0.0.253", "mdns.example.com")
+	if _, found := Host("224.0.0.253"); !found {
+		t.Error("Track() multicast address not tracked when skipping none")
+	}
+}
@@ -0,0 +1,213 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// HostsFile is the system static hosts file.
+	HostsFile = "/etc/hosts"
+	// SourceHosts is the source of the records loaded from a hosts file.
+	// These records don't expire.
+	SourceHosts = "hosts"
+)
+
+// LoadHostsFile tracks the entries of a hosts file, and watches it to track
+// them again whenever it changes, until the context is cancelled.
+func LoadHostsFile(ctx context.Context, path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// editors usually replace the file, so we need to watch the directory.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	loadHosts(path)
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-watcher.Events:
+				if event.Name == path && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+					log.Debug("Hosts file changed, reloading: %s", path)
+					loadHosts(path)
+				}
+			case err := <-watcher.Errors:
+				log.Error("Hosts file watcher error: %s", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// loadHosts tracks the entries of a hosts file, removing the domains that are
+// not in the file anymore.
+// The filter doesn't apply to them, and they're not delivered to the
+// subscribers: they're not DNS records.
+func loadHosts(path string) {
+	hosts, err := parseHostsFile(path)
+	if err != nil {
+		log.Warning("Error reading hosts file %s: %s", path, err)
+	}
+
+	var removed []string
+	forEachEntry(func(resolved string, e *entry) {
+		if _, found := hosts[resolved]; !found && e.hostsFile() {
+			removed = append(removed, resolved)
+		}
+	})
+	now := time.Now()
+	for _, resolved := range removed {
+		setHosts(resolved, nil, now)
+	}
+	for ip, names := range hosts {
+		setHosts(ip, names, now)
+	}
+	log.Debug("%d IPs loaded from hosts file %s", len(hosts), path)
+}
+
+// setHosts replaces the hosts file domains of an IP, keeping the resolved
+// ones. The canonical name must be the first one.
+func setHosts(resolved string, hosts []string, now time.Time) {
+	var evicted []string
+	s := getShard(resolved)
+	s.Lock()
+	defer func() {
+		s.Unlock()
+		notifyEvicted(resolved, evicted...)
+	}()
+
+	e, found := s.entries[resolved]
+	if found && e.static() {
+		return
+	}
+	// the imported entries are replaced, the local hosts file prevails.
+	if !found || e.expired(now) || e.origin != "" {
+		if len(hosts) == 0 {
+			return
+		}
+		if found {
+			evicted = e.hosts
+			unindex(resolved, e.hosts...)
+		}
+		e = &entry{lastSeen: now, source: SourceHosts}
+		s.entries[resolved] = e
+	} else if sameHosts(e.localHosts(), hosts) {
+		return
+	}
+
+	list := make([]string, 0, len(e.hosts))
+	for _, h := range e.hosts {
+		if e.local[h] && !contains(hosts, h) {
+			evicted = append(evicted, h)
+			unindex(resolved, h)
+			delete(e.reverse, h)
+			continue
+		}
+		list = append(list, h)
+	}
+	e.hosts = list
+	e.local = make(map[string]bool, len(hosts))
+	for i := len(hosts) - 1; i >= 0; i-- {
+		delete(e.reverse, hosts[i])
+		e.local[hosts[i]] = true
+		removed := e.addHost(hosts[i])
+		unindex(resolved, removed...)
+		evicted = append(evicted, removed...)
+	}
+	index(resolved, hosts...)
+
+	if len(e.hosts) == 0 {
+		delete(s.entries, resolved)
+	}
+}
+
+// parseHostsFile returns the domains of every IP of a hosts file, with the
+// canonical name first:
+// 192.0.2.1 canonical.example.com alias1 alias2 # comment
+func parseHostsFile(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return make(map[string][]string), err
+	}
+	defer f.Close()
+
+	return parseHostsFileFrom(f)
+}
+
+func parseHostsFileFrom(r io.Reader) (map[string][]string, error) {
+	hosts := make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// fe80::1%lo0
+		addr := strings.SplitN(fields[0], "%", 2)[0]
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = NormalizeHost(name)
+			if !contains(hosts[ip.String()], name) {
+				hosts[ip.String()] = append(hosts[ip.String()], name)
+			}
+		}
+	}
+
+	return hosts, scanner.Err()
+}
+
+// localHosts returns the domains of an entry loaded from the hosts file.
+// It must be called with the lock of its shard held.
+func (e *entry) localHosts() []string {
+	hosts := make([]string, 0, len(e.local))
+	for h := range e.local {
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, h := range a {
+		if !contains(b, h) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package dns
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseHostsFile(t *testing.T) {
+	hosts, err := parseHostsFile("testdata/hosts")
+	if err != nil {
+		t.Fatal("parseHostsFile() error:", err)
+	}
+	if len(hosts) != 5 {
+		t.Error("parseHostsFile() unexpected number of IPs:", hosts)
+	}
+	if names := hosts["192.0.2.240"]; len(names) != 2 || names[0] != "nas.lan" || names[1] != "nas" {
+		t.Error("parseHostsFile() invalid names:", names)
+	}
+	if names := hosts["2001:db8::241"]; len(names) != 2 || names[1] != "printer" {
+		t.Error("parseHostsFile() invalid IPv6 names:", names)
+	}
+}
+
+func TestLoadHosts(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	tmpDir, err := ioutil.TempDir("", "ostest_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	hostsPath := filepath.Join(tmpDir, "hosts")
+
+	ioutil.WriteFile(hostsPath, []byte("192.0.2.250 nas.lan nas\n192.0.2.251 printer.lan\n"), 0644)
+	loadHosts(hostsPath)
+
+	e, found := GetEntry("192.0.2.250")
+	if !found || e.Hosts[0] != "nas.lan" || e.Source != SourceHosts {
+		t.Error("loadHosts() invalid entry:", e, found)
+	}
+	setLastSeen("192.0.2.250", time.Now().Add(-MaxEntryAge-time.Second))
+	if _, found := Host("192.0.2.250"); !found {
+		t.Error("loadHosts() static entries must not expire")
+	}
+
+	ioutil.WriteFile(hostsPath, []byte("192.0.2.250 nas.lan\n"), 0644)
+	loadHosts(hostsPath)
+	if _, found := Host("192.0.2.251"); found {
+		t.Error("loadHosts() removed entry still tracked")
+	}
+	if hosts := Hosts("192.0.2.250"); len(hosts) != 1 || hosts[0] != "nas.lan" {
+		t.Error("loadHosts() changed entry not updated:", hosts)
+	}
+
+	t.Run("Test filter not applied", func(t *testing.T) {
+		SetFilter(Filter{Exclude: []string{"excluded.lan"}})
+		ioutil.WriteFile(hostsPath, []byte("127.0.0.2 myhost\n192.0.2.253 excluded.lan\n"), 0644)
+		events, unsubscribe := Subscribe(8)
+		defer unsubscribe()
+		loadHosts(hostsPath)
+		if host, _ := Host("127.0.0.2"); host != "myhost" {
+			t.Error("loadHosts() loopback entry skipped:", host)
+		}
+		if host, _ := Host("192.0.2.253"); host != "excluded.lan" {
+			t.Error("loadHosts() excluded entry skipped:", host)
+		}
+		select {
+		case ev := <-events:
+			t.Error("loadHosts() entry delivered to the subscribers:", ev)
+		default:
+		}
+	})
+}
+
+func TestHostsResolvedByDNS(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	tmpDir, err := ioutil.TempDir("", "ostest_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	hostsPath := filepath.Join(tmpDir, "hosts")
+
+	ioutil.WriteFile(hostsPath, []byte("192.0.2.252 router.lan\n"), 0644)
+	loadHosts(hostsPath)
+	TrackFrom("192.0.2.252", "router.example.com", nil, "A")
+	if e, _ := GetEntry("192.0.2.252"); len(e.Hosts) != 2 || e.Source != "A" {
+		t.Error("TrackFrom() resolved domain not added:", e)
+	}
+
+	var evicted []string
+	OnEvict(func(resolved, host string) {
+		if resolved == "192.0.2.252" {
+			evicted = append(evicted, host)
+		}
+	})
+	defer func() { evictCallbacks = nil }()
+	setLastSeen("192.0.2.252", time.Now().Add(-MaxEntryAge-time.Second))
+	cleanup(time.Minute)
+
+	e, found := GetEntry("192.0.2.252")
+	if !found || len(e.Hosts) != 1 || e.Hosts[0] != "router.lan" || e.Source != SourceHosts {
+		t.Error("cleanup() hosts file domain not kept:", e, found)
+	}
+	if len(evicted) != 1 || evicted[0] != "router.example.com" {
+		t.Error("cleanup() expired resolved domain not evicted:", evicted)
+	}
+
+	t.Run("Test changed", func(t *testing.T) {
+		TrackFrom("192.0.2.252", "router.example.com", nil, "A")
+		ioutil.WriteFile(hostsPath, []byte("192.0.2.252 gateway.lan\n"), 0644)
+		loadHosts(hostsPath)
+		if hosts := Hosts("192.0.2.252"); len(hosts) != 2 || hosts[0] != "gateway.lan" || hosts[1] != "router.example.com" {
+			t.Error("loadHosts() resolved domain not kept:", hosts)
+		}
+		if ips := GetIPsByHost("router.lan"); len(ips) != 0 {
+			t.Error("loadHosts() removed domain still indexed:", ips)
+		}
+	})
+
+	t.Run("Test MaxHostsPerIP", func(t *testing.T) {
+		oldMax := MaxHostsPerIP
+		MaxHostsPerIP = 1
+		defer func() { MaxHostsPerIP = oldMax }()
+		TrackFrom("192.0.2.252", "a.example.com", nil, "A")
+		TrackFrom("192.0.2.252", "b.example.com", nil, "A")
+		if hosts := Hosts("192.0.2.252"); len(hosts) != 2 || hosts[0] != "b.example.com" || hosts[1] != "gateway.lan" {
+			t.Error("addHost() hosts file domain evicted:", hosts)
+		}
+	})
+}
@@ -0,0 +1,209 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+
+	"github.com/google/gopacket/layers"
+)
+
+// maximum number of IPs waiting for a reverse lookup. IPs are discarded while
+// the queue is full.
+const lazyQueueSize = 64
+
+var (
+	// LazyTimeout is the maximum time to wait for a reverse lookup in lazy
+	// mode.
+	LazyTimeout = time.Second
+	// LazyRetry is the time to wait before trying again to resolve an IP
+	// that could not be resolved in lazy mode.
+	LazyRetry = 10 * time.Minute
+	// LazySize is the maximum number of records kept in lazy mode until a
+	// connection needs them. The oldest ones are discarded.
+	LazySize = 1024
+
+	// lazy is 1 while the lazy mode is enabled.
+	lazy int32
+
+	lazyFailed  = make(map[string]time.Time)
+	lazyPending = make(map[string]bool)
+	lazyLock    = sync.Mutex{}
+	// IPs waiting for a reverse lookup.
+	lazyQueue = make(chan string, lazyQueueSize)
+	lazyOnce  sync.Once
+
+	// records kept in lazy mode, by the value they resolve to, and their
+	// keys from the oldest to the newest.
+	lazyRecords     = make(map[string]lazyRecord)
+	lazyOrder       []lazyKey
+	lazySeq         uint64
+	lazyRecordsLock = sync.Mutex{}
+
+	lookupAddr = net.DefaultResolver.LookupAddr
+)
+
+type lazyRecord struct {
+	name   string
+	source string
+	server net.IP
+	time   time.Time
+	seq    uint64
+}
+
+type lazyKey struct {
+	value string
+	seq   uint64
+}
+
+// SetLazy enables or disables the lazy mode, meant for constrained devices.
+// In lazy mode, the DNS responses are not tracked: the last LazySize records
+// are only kept, and the domain of an IP is only tracked when a connection to
+// it is evaluated, from the kept records or with a reverse lookup (see
+// LookupLater()).
+// It lowers the overhead of tracking every response, at the cost of missing
+// the domains whose records have been discarded, which may only be resolved
+// by a (less reliable) reverse lookup, if at all.
+func SetLazy(enabled bool) {
+	if enabled {
+		lazyOnce.Do(func() { go lazyWorker() })
+		atomic.StoreInt32(&lazy, 1)
+		log.Info("DNS tracking in lazy mode")
+		return
+	}
+	atomic.StoreInt32(&lazy, 0)
+
+	lazyRecordsLock.Lock()
+	lazyRecords = make(map[string]lazyRecord)
+	lazyOrder = nil
+	lazyRecordsLock.Unlock()
+}
+
+// Lazy returns if the lazy mode is enabled.
+func Lazy() bool {
+	return atomic.LoadInt32(&lazy) == 1
+}
+
+// keepRecord keeps a record in lazy mode, until a connection needs it.
+func keepRecord(ans *layers.DNSResourceRecord, server net.IP) TrackResult {
+	value := recordValue(ans)
+	if ans.Name == nil || value == "" {
+		return TrackSkipped
+	}
+
+	lazyRecordsLock.Lock()
+	defer lazyRecordsLock.Unlock()
+	lazySeq++
+	lazyRecords[value] = lazyRecord{name: string(ans.Name), source: ans.Type.String(), server: server, time: time.Now(), seq: lazySeq}
+	lazyOrder = append(lazyOrder, lazyKey{value: value, seq: lazySeq})
+	for len(lazyOrder) > LazySize {
+		// the key may have been kept again since, with a newer record.
+		if rec, found := lazyRecords[lazyOrder[0].value]; found && rec.seq == lazyOrder[0].seq {
+			delete(lazyRecords, lazyOrder[0].value)
+		}
+		lazyOrder = lazyOrder[1:]
+	}
+	return TrackSkipped
+}
+
+// resolveLazy tracks the domain of an IP from the records kept. It returns
+// true if it was tracked.
+func resolveLazy(ip string) bool {
+	return !Paused() && trackKept(ip)
+}
+
+// LookupLater queues a reverse lookup of an IP without domain in lazy mode,
+// so the next connections to it have one.
+// The lookups are made from a different goroutine, so the connections are
+// never delayed by them. The system resolvers are never looked up, since the
+// lookups themselves connect to them, and nothing is looked up while the
+// tracking is paused.
+func LookupLater(ip net.IP) {
+	if !Lazy() || Paused() || IsSystemResolver(ip) {
+		return
+	}
+	resolved := ip.String()
+	if _, found := Host(resolved); found {
+		return
+	}
+
+	lazyLock.Lock()
+	defer lazyLock.Unlock()
+	if failed, found := lazyFailed[resolved]; lazyPending[resolved] || (found && time.Since(failed) < LazyRetry) {
+		return
+	}
+	select {
+	case lazyQueue <- resolved:
+		lazyPending[resolved] = true
+	default:
+	}
+}
+
+func lazyWorker() {
+	for ip := range lazyQueue {
+		if Lazy() && !Paused() {
+			lookupReverse(ip)
+		}
+		lazyLock.Lock()
+		delete(lazyPending, ip)
+		lazyLock.Unlock()
+	}
+}
+
+// lookupReverse tracks the domain of an IP with a reverse lookup, and
+// remembers the failed ones to not retry them before LazyRetry.
+func lookupReverse(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), LazyTimeout)
+	defer cancel()
+	names, err := lookupAddr(ctx, ip)
+	if err == nil && len(names) > 0 && TrackFrom(ip, names[0], nil, layers.DNSTypePTR.String()) != TrackSkipped {
+		return
+	}
+
+	lazyLock.Lock()
+	now := time.Now()
+	// don't let it grow with all the IPs without domain.
+	for failedIP, t := range lazyFailed {
+		if now.Sub(t) >= LazyRetry {
+			delete(lazyFailed, failedIP)
+		}
+	}
+	lazyFailed[ip] = now
+	lazyLock.Unlock()
+}
+
+// trackKept tracks the domain of an IP, and its aliases, from the most recent
+// records kept that resolved them.
+func trackKept(ip string) bool {
+	type link struct {
+		value string
+		rec   lazyRecord
+	}
+	var chain []link
+	now := time.Now()
+
+	lazyRecordsLock.Lock()
+	// CNAMEs point to the next record: www.example.com -> cdn.example.net -> IP
+	for value, seen := ip, make(map[string]bool); !seen[value]; {
+		seen[value] = true
+		rec, found := lazyRecords[value]
+		if !found || now.Sub(rec.time) > MaxEntryAge {
+			break
+		}
+		chain = append(chain, link{value: value, rec: rec})
+		value = NormalizeHost(rec.name)
+	}
+	lazyRecordsLock.Unlock()
+
+	tracked := false
+	for _, l := range chain {
+		if TrackFrom(l.value, l.rec.name, l.rec.server, l.rec.source) != TrackSkipped {
+			tracked = true
+		}
+	}
+	return tracked
+}
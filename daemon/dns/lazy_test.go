@@ -0,0 +1,154 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestLazy(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	SetLazy(true)
+	defer SetLazy(false)
+	// the records are kept even without recent responses.
+	SetRecentSize(0)
+	defer SetRecentSize(DefaultRecentSize)
+	for _, ip := range []string{"198.51.100.130", "198.51.100.131", "198.51.100.132", "198.51.100.133", "198.51.100.136"} {
+		ForgetIP(ip)
+	}
+	lazyLock.Lock()
+	lazyFailed = make(map[string]time.Time)
+	lazyLock.Unlock()
+
+	var lookups int32
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		if addr == "198.51.100.131" {
+			return []string{"ptr.lazy.example.com."}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	defer func() { lookupAddr = net.DefaultResolver.LookupAddr }()
+
+	TrackAnswers(newResponse(t, "192.168.1.1",
+		layers.DNSResourceRecord{
+			Name:  []byte("www.lazy.example.com"),
+			Type:  layers.DNSTypeCNAME,
+			Class: layers.DNSClassIN,
+			CNAME: []byte("cdn.lazy.example.net"),
+		},
+		layers.DNSResourceRecord{
+			Name:  []byte("cdn.lazy.example.net"),
+			Type:  layers.DNSTypeA,
+			Class: layers.DNSClassIN,
+			IP:    net.ParseIP("198.51.100.130"),
+		},
+	))
+
+	t.Run("Test not tracked", func(t *testing.T) {
+		if _, found := Host("198.51.100.130"); found {
+			t.Error("TrackAnswers() response tracked in lazy mode")
+		}
+	})
+	t.Run("Test kept record", func(t *testing.T) {
+		if h := HostOr(net.ParseIP("198.51.100.130"), ""); h != "www.lazy.example.com" {
+			t.Error("HostOr() domain not resolved from the records kept:", h)
+		}
+		if atomic.LoadInt32(&lookups) != 0 {
+			t.Error("HostOr() unexpected reverse lookup")
+		}
+	})
+	t.Run("Test reverse lookup", func(t *testing.T) {
+		ip := net.ParseIP("198.51.100.131")
+		if h := HostOr(ip, ""); h != "" {
+			t.Error("HostOr() domain resolved without a record kept:", h)
+		}
+		LookupLater(ip)
+		if h, found := WaitForHost(context.Background(), ip.String(), 5*time.Second); !found || h != "ptr.lazy.example.com" {
+			t.Error("LookupLater() domain not resolved with a reverse lookup:", h)
+		}
+	})
+	t.Run("Test LazySize", func(t *testing.T) {
+		oldSize := LazySize
+		LazySize = 2
+		defer func() { LazySize = oldSize }()
+		for i := 0; i < 3; i++ {
+			keepRecord(&layers.DNSResourceRecord{
+				Name: []byte("size.lazy.example.com"),
+				Type: layers.DNSTypeA,
+				IP:   net.ParseIP(fmt.Sprint("198.51.100.13", 4+i)),
+			}, nil)
+		}
+		lazyRecordsLock.Lock()
+		n, order := len(lazyRecords), len(lazyOrder)
+		lazyRecordsLock.Unlock()
+		if n != 2 || order != 2 {
+			t.Error("keepRecord() more records kept than LazySize:", n, order)
+		}
+		if h := HostOr(net.ParseIP("198.51.100.134"), ""); h != "" {
+			t.Error("HostOr() domain resolved from a discarded record:", h)
+		}
+		if h := HostOr(net.ParseIP("198.51.100.136"), ""); h != "size.lazy.example.com" {
+			t.Error("HostOr() domain not resolved from the last record kept:", h)
+		}
+	})
+	t.Run("Test failed lookup", func(t *testing.T) {
+		atomic.StoreInt32(&lookups, 0)
+		ip := net.ParseIP("198.51.100.132")
+		LookupLater(ip)
+		waitLazyFailed(t, ip.String())
+		LookupLater(ip)
+		waitLazyIdle(t)
+		if n := atomic.LoadInt32(&lookups); n != 1 {
+			t.Error("LookupLater() failed lookup retried:", n)
+		}
+	})
+	t.Run("Test system resolvers and pause", func(t *testing.T) {
+		atomic.StoreInt32(&lookups, 0)
+		LookupLater(net.ParseIP("127.0.0.53"))
+		ForgetIP("198.51.100.130")
+		Pause()
+		LookupLater(net.ParseIP("198.51.100.133"))
+		if h := HostOr(net.ParseIP("198.51.100.130"), ""); h != "" {
+			t.Error("HostOr() domain resolved while paused:", h)
+		}
+		Resume()
+		waitLazyIdle(t)
+		if n := atomic.LoadInt32(&lookups); n != 0 {
+			t.Error("LookupLater() unexpected reverse lookup:", n)
+		}
+	})
+}
+
+func waitLazyFailed(t *testing.T, ip string) {
+	for i := 0; i < 500; i++ {
+		lazyLock.Lock()
+		_, failed := lazyFailed[ip]
+		lazyLock.Unlock()
+		if failed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("LookupLater() lookup not made:", ip)
+}
+
+func waitLazyIdle(t *testing.T) {
+	for i := 0; i < 500; i++ {
+		lazyLock.Lock()
+		n := len(lazyPending)
+		lazyLock.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("LookupLater() lookups not finished")
+}
@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+	"github.com/google/gopacket/layers"
+)
+
+// Merge imports the entries of a snapshot taken by another instance,
+// tagging them with its origin, in order to aggregate the domains tracked by
+// several hosts.
+// An imported entry replaces the local one only if it has been seen more
+// recently, and its domains are placed first. The static entries of the local
+// hosts file are never replaced.
+// Imported entries are not delivered to the subscribers.
+// It returns the number of entries merged.
+func Merge(snapshot map[string]Entry, origin string) (merged int) {
+	f := getFilter()
+	now := time.Now()
+
+	for resolved, imp := range snapshot {
+		if net.ParseIP(resolved) == nil && NormalizeHost(resolved) != resolved {
+			continue
+		}
+		if now.Sub(imp.LastSeen) > MaxEntryAge || !f.acceptIP(resolved) {
+			continue
+		}
+		// the clock of the other instance may be ahead: an entry seen in the
+		// future would never expire, and always replace the local one.
+		if imp.LastSeen.After(now) {
+			imp.LastSeen = now
+		}
+		hosts := make([]string, 0, len(imp.Hosts))
+		for _, h := range imp.Hosts {
+			if h = NormalizeHost(h); h != "" && f.matchHost(h) {
+				hosts = append(hosts, h)
+			}
+		}
+		if len(hosts) > 0 && mergeEntry(resolved, hosts, &imp, origin, now) {
+			merged++
+		}
+	}
+
+	log.Debug("%d of %d DNS entries merged from %s", merged, len(snapshot), origin)
+	return merged
+}
+
+// mergeEntry replaces the local entry of an IP with an imported one, if it's
+// newer.
+func mergeEntry(resolved string, hosts []string, imp *Entry, origin string, now time.Time) bool {
+	var evicted []string
+	s := getShard(resolved)
+	s.Lock()
+	defer func() {
+		s.Unlock()
+		notifyEvicted(resolved, evicted...)
+	}()
+
+	e, found := s.entries[resolved]
+	if found && !e.expired(now) {
+		if e.hostsFile() || e.static() || !imp.LastSeen.After(e.lastSeen) {
+			return false
+		}
+	} else {
+		if found {
+			evicted = e.hosts
+			unindex(resolved, e.hosts...)
+		}
+		e = &entry{}
+		s.entries[resolved] = e
+	}
+	// only the most recent imported domains fit.
+	if MaxHostsPerIP > 0 && len(hosts) > MaxHostsPerIP {
+		hosts = hosts[:MaxHostsPerIP]
+	}
+	// the most recent domain must end up first. The trust of the imported
+	// entry only applies to it.
+	for i := len(hosts) - 1; i >= 0; i-- {
+		if i == 0 {
+			source := ""
+			if imp.LowTrust {
+				source = layers.DNSTypePTR.String()
+			}
+			e.setTrust(hosts[i], source)
+		}
+		removed := e.addHost(hosts[i])
+		unindex(resolved, removed...)
+		evicted = append(evicted, removed...)
+	}
+	index(resolved, hosts...)
+	e.lastSeen = imp.LastSeen
+	e.server = imp.Server
+	e.bypassed = imp.Bypassed
+	e.source = imp.Source
+	e.origin = origin
+	return true
+}
+
+// MergeFrom reads a snapshot of another instance encoded as JSON, as returned
+// by Snapshot(), and merges it.
+func MergeFrom(r io.Reader, origin string) (merged int, err error) {
+	var snapshot map[string]Entry
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return 0, err
+	}
+	return Merge(snapshot, origin), nil
+}
@@ -0,0 +1,137 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	now := time.Now()
+	Track("198.51.100.60", "local.merge.example.com")
+	Track("198.51.100.61", "newer-local.merge.example.com")
+	setHosts("198.51.100.62", []string{"static.merge.example.com"}, now)
+	setLastSeen("198.51.100.60", now.Add(-time.Hour))
+
+	merged := Merge(map[string]Entry{
+		"198.51.100.60": {Hosts: []string{"Remote.merge.example.com."}, LastSeen: now, Source: "A"},
+		"198.51.100.61": {Hosts: []string{"older-remote.merge.example.com"}, LastSeen: now.Add(-time.Hour)},
+		"198.51.100.62": {Hosts: []string{"remote-static.merge.example.com"}, LastSeen: now},
+		"198.51.100.63": {Hosts: []string{"new.merge.example.com"}, LastSeen: now},
+		"198.51.100.64": {Hosts: []string{"stale.merge.example.com"}, LastSeen: now.Add(-2 * MaxEntryAge)},
+		"198.51.100.65": {Hosts: []string{""}, LastSeen: now},
+	}, "host1")
+	if merged != 2 {
+		t.Error("Merge() unexpected number of entries merged:", merged)
+	}
+
+	t.Run("newest wins", func(t *testing.T) {
+		e, _ := GetEntry("198.51.100.60")
+		if e.Hosts[0] != "remote.merge.example.com" || e.Origin != "host1" || e.Source != "A" {
+			t.Error("Merge() newer entry not merged:", e)
+		}
+		if len(GetIPsByHost("remote.merge.example.com")) != 1 {
+			t.Error("Merge() merged domain not indexed")
+		}
+		e, _ = GetEntry("198.51.100.61")
+		if e.Hosts[0] != "newer-local.merge.example.com" || e.Origin != "" {
+			t.Error("Merge() older entry merged:", e)
+		}
+	})
+	t.Run("static entries", func(t *testing.T) {
+		if h, _ := Host("198.51.100.62"); h != "static.merge.example.com" {
+			t.Error("Merge() static entry replaced:", h)
+		}
+	})
+	t.Run("new and stale entries", func(t *testing.T) {
+		if e, _ := GetEntry("198.51.100.63"); e.Origin != "host1" {
+			t.Error("Merge() new entry not merged:", e)
+		}
+		if _, found := Host("198.51.100.64"); found {
+			t.Error("Merge() stale entry merged")
+		}
+		if _, found := Host("198.51.100.65"); found {
+			t.Error("Merge() entry without domains merged")
+		}
+	})
+	t.Run("clock ahead", func(t *testing.T) {
+		Merge(map[string]Entry{
+			"198.51.100.68": {Hosts: []string{"future.merge.example.com"}, LastSeen: now.Add(MaxEntryAge)},
+		}, "host1")
+		if e, _ := GetEntry("198.51.100.68"); e.LastSeen.After(time.Now()) {
+			t.Error("Merge() entry seen in the future not clamped:", e.LastSeen)
+		}
+	})
+	t.Run("low trust", func(t *testing.T) {
+		Merge(map[string]Entry{
+			"198.51.100.69": {Hosts: []string{"ptr.merge.example.com", "forward.merge.example.com"}, LastSeen: now, Source: "PTR", LowTrust: true},
+		}, "host1")
+		s := getShard("198.51.100.69")
+		s.RLock()
+		reverse := s.entries["198.51.100.69"].reverse
+		s.RUnlock()
+		if !reverse["ptr.merge.example.com"] || reverse["forward.merge.example.com"] {
+			t.Error("Merge() low trust not applied to the first domain only:", reverse)
+		}
+	})
+	t.Run("tracked again", func(t *testing.T) {
+		Track("198.51.100.63", "new.merge.example.com")
+		if e, _ := GetEntry("198.51.100.63"); e.Origin != "" {
+			t.Error("Merge() origin not cleared when tracked locally:", e)
+		}
+	})
+}
+
+func TestMergeEvicted(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	oldMax := MaxHostsPerIP
+	MaxHostsPerIP = 2
+	defer func() {
+		MaxHostsPerIP = oldMax
+		evictCallbacks = nil
+	}()
+	now := time.Now()
+	Track("198.51.100.66", "a.evict.example.com")
+	Track("198.51.100.66", "b.evict.example.com")
+	Track("198.51.100.67", "expired.evict.example.com")
+	setLastSeen("198.51.100.66", now.Add(-time.Second))
+	setLastSeen("198.51.100.67", now.Add(-2*MaxEntryAge))
+
+	evicted := make(map[string]bool)
+	OnEvict(func(ip, host string) {
+		evicted[ip+" "+host] = true
+	})
+	Merge(map[string]Entry{
+		"198.51.100.66": {Hosts: []string{"c.evict.example.com", "d.evict.example.com", "e.evict.example.com"}, LastSeen: now},
+		"198.51.100.67": {Hosts: []string{"new.evict.example.com"}, LastSeen: now},
+	}, "host1")
+
+	if len(evicted) != 3 || !evicted["198.51.100.66 a.evict.example.com"] || !evicted["198.51.100.66 b.evict.example.com"] ||
+		!evicted["198.51.100.67 expired.evict.example.com"] {
+		t.Error("Merge() evicted domains not notified:", evicted)
+	}
+	if hosts := Hosts("198.51.100.66"); len(hosts) != 2 || hosts[0] != "c.evict.example.com" {
+		t.Error("Merge() invalid domains:", hosts)
+	}
+	if ips := GetIPsByHost("e.evict.example.com"); len(ips) != 0 {
+		t.Error("Merge() domain not merged indexed:", ips)
+	}
+}
+
+func TestMergeFrom(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	js := `{"198.51.100.66": {"hosts": ["json.merge.example.com"], "last_seen": "` + time.Now().Format(time.RFC3339Nano) + `"}}`
+	if merged, err := MergeFrom(strings.NewReader(js), "host2"); err != nil || merged != 1 {
+		t.Error("MergeFrom() error:", merged, err)
+	}
+	if h, _ := Host("198.51.100.66"); h != "json.merge.example.com" {
+		t.Error("MergeFrom() entry not merged:", h)
+	}
+	if _, err := MergeFrom(strings.NewReader("{"), "host2"); err == nil {
+		t.Error("MergeFrom() invalid snapshot accepted")
+	}
+}
@@ -0,0 +1,44 @@
+package dns
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// NormalizeHost returns the canonical form of a domain: lowercase, without the
+// trailing dot, and internationalized domains encoded in ASCII (punycode), as
+// they're sent over the wire.
+// müller.example -> xn--mller-kva.example
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !isASCII(host) {
+		if ascii, err := idna.ToASCII(host); err == nil {
+			host = ascii
+		}
+	}
+	return host
+}
+
+// UnicodeHost returns the unicode form of a normalized internationalized
+// domain, or the domain itself if it's not one.
+// xn--mller-kva.example -> müller.example
+func UnicodeHost(host string) string {
+	if !strings.Contains(host, "xn--") {
+		return host
+	}
+	if u, err := idna.ToUnicode(host); err == nil {
+		return u
+	}
+	return host
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	hosts := map[string]string{
+		"müller.example":        "xn--mller-kva.example",
+		"MÜLLER.example.":       "xn--mller-kva.example",
+		"xn--mller-kva.example": "xn--mller-kva.example",
+		"WWW.OpenSnitch.io.":    "www.opensnitch.io",
+		"":                      "",
+	}
+	for host, expected := range hosts {
+		if normalized := NormalizeHost(host); normalized != expected {
+			t.Errorf("NormalizeHost(%s) = %s, expected %s", host, normalized, expected)
+		}
+	}
+
+	t.Run("Test UnicodeHost", func(t *testing.T) {
+		if host := UnicodeHost("xn--mller-kva.example"); host != "müller.example" {
+			t.Error("UnicodeHost() invalid unicode form:", host)
+		}
+		if host := UnicodeHost("www.opensnitch.io"); host != "www.opensnitch.io" {
+			t.Error("UnicodeHost() not internationalized domain changed:", host)
+		}
+	})
+
+	t.Run("Test Track IDN", func(t *testing.T) {
+		Track("192.0.2.80", "müller.example")
+		if host, _ := Host("192.0.2.80"); host != "xn--mller-kva.example" {
+			t.Error("Track() host not normalized:", host)
+		}
+	})
+}
@@ -5,7 +5,8 @@ import (
 	"github.com/google/gopacket/layers"
 )
 
-// GetQuestions retrieves the domain names a process is trying to resolve.
+// GetQuestions retrieves the domain names a process is trying to resolve,
+// normalized as the tracked ones.
 func GetQuestions(nfp *netfilter.Packet) (questions []string) {
 	dnsLayer := nfp.Packet.Layer(layers.LayerTypeDNS)
 	if dnsLayer == nil {
@@ -14,7 +15,7 @@ func GetQuestions(nfp *netfilter.Packet) (questions []string) {
 
 	dns, _ := dnsLayer.(*layers.DNS)
 	for _, dnsQuestion := range dns.Questions {
-		questions = append(questions, string(dnsQuestion.Name))
+		questions = append(questions, NormalizeHost(string(dnsQuestion.Name)))
 	}
 
 	return questions
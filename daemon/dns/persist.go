@@ -0,0 +1,36 @@
+package dns
+
+import (
+	"context"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+)
+
+// Backend stores the tracked records persistently.
+type Backend interface {
+	Store(ev Event) error
+}
+
+// Persist stores the tracked records in a backend until the context is
+// cancelled.
+// Records are queued, up to queueSize, and sent to the backend from a
+// different goroutine, so a slow or unavailable backend never blocks the
+// tracking. If the queue is full the records are discarded, and counted in
+// the DroppedEvents stat, while the cache stays up to date.
+func Persist(ctx context.Context, backend Backend, queueSize int) {
+	events, unsubscribe := Subscribe(queueSize)
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-events:
+				if err := backend.Store(ev); err != nil {
+					log.Debug("Error persisting DNS record %s -> %s: %s", ev.IP, ev.Host, err)
+				}
+			}
+		}
+	}()
+}
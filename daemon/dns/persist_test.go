@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// hangingBackend never returns until it's released.
+type hangingBackend struct {
+	release chan bool
+}
+
+func (b *hangingBackend) Store(ev Event) error {
+	<-b.release
+	return nil
+}
+
+func TestPersistHangingBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := &hangingBackend{release: make(chan bool)}
+	subscribed := numSubscribers()
+	defer func() {
+		// stop it before releasing the backend, and wait for it to
+		// unsubscribe, so it doesn't receive the records of other tests.
+		cancel()
+		close(backend.release)
+		for i := 0; i < 100 && numSubscribers() > subscribed; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	dropped := GetStats().DroppedEvents
+	Persist(ctx, backend, 4)
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			Track(fmt.Sprint("198.18.0.", i), fmt.Sprint("host", i, ".example.com"))
+		}
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Track() blocked by a hanging backend")
+	}
+	if _, found := Host("198.18.0.99"); !found {
+		t.Error("Track() record not tracked while the backend is hanging")
+	}
+	if GetStats().DroppedEvents == dropped {
+		t.Error("Persist() discarded records not counted")
+	}
+}
@@ -0,0 +1,123 @@
+package dns
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// RecentRecord holds a decoded record of a recent DNS response, and how it was
+// tracked.
+type RecentRecord struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Result string `json:"result"`
+}
+
+// RecentResponse holds a recent DNS response, to debug how it was tracked.
+type RecentResponse struct {
+	Time    time.Time      `json:"time"`
+	Server  string         `json:"server,omitempty"`
+	Records []RecentRecord `json:"records"`
+	// Raw is the DNS payload of the packet.
+	Raw []byte `json:"raw"`
+}
+
+// DefaultRecentSize is the default number of recent DNS responses kept.
+const DefaultRecentSize = 16
+
+var (
+	recent     = make([]RecentResponse, DefaultRecentSize)
+	recentNext = 0
+	recentLen  = 0
+	recentLock = sync.Mutex{}
+)
+
+// SetRecentSize sets the number of recent DNS responses kept, discarding the
+// current ones. 0 disables it.
+func SetRecentSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	recentLock.Lock()
+	defer recentLock.Unlock()
+
+	recent = make([]RecentResponse, size)
+	recentNext = 0
+	recentLen = 0
+}
+
+// RecentResponses returns the last DNS responses tracked, from the oldest to
+// the newest.
+func RecentResponses() []RecentResponse {
+	recentLock.Lock()
+	defer recentLock.Unlock()
+
+	list := make([]RecentResponse, 0, recentLen)
+	for i := recentLen; i > 0; i-- {
+		list = append(list, recent[(recentNext-i+len(recent))%len(recent)])
+	}
+	return list
+}
+
+// newRecentResponse returns a response to be filled with its records, or
+// nil if the recent responses are disabled.
+func newRecentResponse(raw []byte, server net.IP) *RecentResponse {
+	recentLock.Lock()
+	enabled := len(recent) > 0
+	recentLock.Unlock()
+	if !enabled {
+		return nil
+	}
+
+	// the packet buffer is reused by the queue.
+	rec := &RecentResponse{Time: time.Now(), Raw: make([]byte, len(raw))}
+	copy(rec.Raw, raw)
+	if server != nil {
+		rec.Server = server.String()
+	}
+	return rec
+}
+
+func (r *RecentResponse) add(ans *layers.DNSResourceRecord, result TrackResult) {
+	if r == nil {
+		return
+	}
+	var value string
+	switch {
+	case ans.IP != nil:
+		value = ans.IP.String()
+	case ans.CNAME != nil:
+		value = string(ans.CNAME)
+	case ans.Type == layers.DNSTypeSRV:
+		value = string(ans.SRV.Name)
+	case ans.Type == layers.DNSTypeMX:
+		value = string(ans.MX.Name)
+	}
+	r.Records = append(r.Records, RecentRecord{
+		Name:   string(ans.Name),
+		Type:   ans.Type.String(),
+		Value:  value,
+		Result: result.String(),
+	})
+}
+
+func (r *RecentResponse) save() {
+	if r == nil {
+		return
+	}
+	recentLock.Lock()
+	defer recentLock.Unlock()
+
+	if len(recent) == 0 {
+		return
+	}
+	recent[recentNext] = *r
+	recentNext = (recentNext + 1) % len(recent)
+	if recentLen < len(recent) {
+		recentLen++
+	}
+}
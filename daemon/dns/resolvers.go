@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ResolvConfPaths are the files where the system nameservers are configured.
+	// The second one lists the upstream servers used by systemd-resolved.
+	ResolvConfPaths = []string{"/etc/resolv.conf", "/run/systemd/resolve/resolv.conf"}
+	// ResolvCheckInterval is the minimum time between two checks of the
+	// nameservers config files.
+	ResolvCheckInterval = 5 * time.Second
+
+	nameservers    = make(map[string]bool)
+	resolvModTimes = make(map[string]time.Time)
+	resolvLock     = sync.RWMutex{}
+	// last time the config files were checked, in Unix nanoseconds.
+	resolvChecked int64
+)
+
+// IsSystemResolver checks if an IP is one of the nameservers configured in
+// the system.
+// Loopback addresses are considered system resolvers, since they're usually
+// local caching daemons (systemd-resolved, dnsmasq, ...).
+// The nameservers are cached, and the config files checked again at most
+// every ResolvCheckInterval.
+func IsSystemResolver(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	now := time.Now().UnixNano()
+	if last := atomic.LoadInt64(&resolvChecked); now-last >= int64(ResolvCheckInterval) && atomic.CompareAndSwapInt64(&resolvChecked, last, now) {
+		reloadNameservers()
+	}
+
+	resolvLock.RLock()
+	defer resolvLock.RUnlock()
+	return nameservers[ip.String()]
+}
+
+// reloadNameservers parses again the nameservers if any of the config files
+// changed since the last time they were read.
+func reloadNameservers() {
+	modTimes := make(map[string]time.Time)
+	resolvLock.RLock()
+	changed := len(resolvModTimes) != len(ResolvConfPaths)
+	for _, path := range ResolvConfPaths {
+		// missing files have a zero time.
+		modTimes[path] = time.Time{}
+		if st, err := os.Stat(path); err == nil {
+			modTimes[path] = st.ModTime()
+		}
+		if old, found := resolvModTimes[path]; !found || !modTimes[path].Equal(old) {
+			changed = true
+		}
+	}
+	resolvLock.RUnlock()
+	if !changed {
+		return
+	}
+
+	servers := make(map[string]bool)
+	for path := range modTimes {
+		for _, ns := range parseNameservers(path) {
+			servers[ns] = true
+		}
+	}
+
+	resolvLock.Lock()
+	nameservers = servers
+	resolvModTimes = modTimes
+	resolvLock.Unlock()
+}
+
+// parseNameservers returns the nameservers of a resolv.conf file.
+func parseNameservers(path string) (servers []string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return servers
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// IPv6 link-local servers may have a zone: fe80::1%eth0
+		addr := strings.SplitN(fields[1], "%", 2)[0]
+		if ip := net.ParseIP(addr); ip != nil {
+			servers = append(servers, ip.String())
+		}
+	}
+
+	return servers
+}
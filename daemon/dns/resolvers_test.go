@@ -0,0 +1,61 @@
+package dns
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSystemResolvers(t *testing.T) {
+	oldPaths := ResolvConfPaths
+	ResolvConfPaths = []string{"testdata/resolv.conf", "/non/existent/resolv.conf"}
+	atomic.StoreInt64(&resolvChecked, 0)
+	defer func() {
+		ResolvConfPaths = oldPaths
+		atomic.StoreInt64(&resolvChecked, 0)
+	}()
+
+	t.Run("Test parse nameservers", func(t *testing.T) {
+		servers := parseNameservers("testdata/resolv.conf")
+		if len(servers) != 2 || servers[0] != "192.168.1.1" || servers[1] != "fe80::1" {
+			t.Error("parseNameservers() invalid servers:", servers)
+		}
+	})
+
+	t.Run("Test IsSystemResolver", func(t *testing.T) {
+		if !IsSystemResolver(net.ParseIP("192.168.1.1")) {
+			t.Error("IsSystemResolver() configured nameserver not detected")
+		}
+		if !IsSystemResolver(net.ParseIP("127.0.0.53")) {
+			t.Error("IsSystemResolver() loopback nameserver not detected")
+		}
+		if IsSystemResolver(net.ParseIP("8.8.8.8")) {
+			t.Error("IsSystemResolver() not configured nameserver detected")
+		}
+	})
+
+	t.Run("Test cached nameservers", func(t *testing.T) {
+		ResolvConfPaths = []string{"/non/existent/resolv.conf"}
+		defer func() { ResolvConfPaths = []string{"testdata/resolv.conf"} }()
+		if !IsSystemResolver(net.ParseIP("192.168.1.1")) {
+			t.Error("IsSystemResolver() config files checked before ResolvCheckInterval")
+		}
+		atomic.StoreInt64(&resolvChecked, 0)
+		if IsSystemResolver(net.ParseIP("192.168.1.1")) {
+			t.Error("IsSystemResolver() config files not checked after ResolvCheckInterval")
+		}
+		atomic.StoreInt64(&resolvChecked, 0)
+	})
+
+	t.Run("Test TrackFrom", func(t *testing.T) {
+		TrackFrom("140.82.121.4", "github.com", net.ParseIP("192.168.1.1"), "A")
+		TrackFrom("140.82.121.5", "api.github.com", net.ParseIP("1.1.1.1"), "A")
+
+		if server, bypassed, found := GetResolver("140.82.121.4"); !found || bypassed || server != "192.168.1.1" {
+			t.Error("GetResolver() invalid system resolver:", server, bypassed, found)
+		}
+		if server, bypassed, found := GetResolver("140.82.121.5"); !found || !bypassed || server != "1.1.1.1" {
+			t.Error("GetResolver() bypass not detected:", server, bypassed, found)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+// numShards is the number of parts the list is split into.
+const numShards = 32
+
+// shard holds a part of the list, selected by the hash of the resolved value,
+// so the tracking and the lookups of different IPs don't contend.
+// To avoid deadlocks, the lock of a shard is never held while acquiring the
+// lock of another shard, and the index lock is always acquired after the lock
+// of a shard, never before.
+type shard struct {
+	sync.RWMutex
+	entries map[string]*entry
+}
+
+var (
+	shards = newShards(numShards)
+
+	// hostIPs is the reverse index of the list: domain -> IPs
+	hostIPs   = make(map[string]map[string]bool)
+	indexLock = sync.RWMutex{}
+)
+
+func newShards(n int) []*shard {
+	list := make([]*shard, n)
+	for i := range list {
+		list[i] = &shard{entries: make(map[string]*entry)}
+	}
+	return list
+}
+
+// getShard returns the shard of a resolved value (FNV-1a hash).
+func getShard(resolved string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(resolved); i++ {
+		h ^= uint32(resolved[i])
+		h *= 16777619
+	}
+	return shards[h%uint32(len(shards))]
+}
+
+// forEachEntry calls a function for every entry of the list, holding the lock
+// of its shard for reading.
+func forEachEntry(fn func(resolved string, e *entry)) {
+	for _, s := range shards {
+		s.RLock()
+		for resolved, e := range s.entries {
+			fn(resolved, e)
+		}
+		s.RUnlock()
+	}
+}
+
+// forEachEntryAtOnce calls a function for every entry of the list, holding
+// the locks of all the shards for reading, so it sees the list at a single
+// point in time.
+// The locks are taken in the order of the shards. It can't deadlock, since
+// no other function holds more than one shard lock at once.
+func forEachEntryAtOnce(fn func(resolved string, e *entry)) {
+	for _, s := range shards {
+		s.RLock()
+	}
+	defer func() {
+		for _, s := range shards {
+			s.RUnlock()
+		}
+	}()
+
+	for _, s := range shards {
+		for resolved, e := range s.entries {
+			fn(resolved, e)
+		}
+	}
+}
+
+// alive returns the source of an entry, if it's in the list and has not
+// expired.
+func alive(resolved string, now time.Time) (source string, found bool) {
+	s := getShard(resolved)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[resolved]
+	if !found || e.expired(now) {
+		return "", false
+	}
+	return e.source, true
+}
+
+// index adds the domains of an IP to the reverse index.
+func index(resolved string, hosts ...string) {
+	// they're usually indexed already, when the records are refreshed.
+	indexLock.RLock()
+	missing := false
+	for _, host := range hosts {
+		if !hostIPs[host][resolved] {
+			missing = true
+			break
+		}
+	}
+	indexLock.RUnlock()
+	if !missing {
+		return
+	}
+
+	indexLock.Lock()
+	defer indexLock.Unlock()
+
+	for _, host := range hosts {
+		ips, found := hostIPs[host]
+		if !found {
+			ips = make(map[string]bool)
+			hostIPs[host] = ips
+		}
+		ips[resolved] = true
+	}
+}
+
+// unindex removes domains of an IP from the reverse index.
+func unindex(resolved string, hosts ...string) {
+	if len(hosts) == 0 {
+		return
+	}
+	indexLock.Lock()
+	defer indexLock.Unlock()
+
+	for _, host := range hosts {
+		if ips, found := hostIPs[host]; found {
+			delete(ips, resolved)
+			if len(ips) == 0 {
+				delete(hostIPs, host)
+			}
+		}
+	}
+}
+
+// indexed returns the values a domain has been resolved to, according to the
+// reverse index. They may have expired.
+func indexed(host string) []string {
+	indexLock.RLock()
+	defer indexLock.RUnlock()
+
+	list := make([]string, 0, len(hostIPs[host]))
+	for resolved := range hostIPs[host] {
+		list = append(list, resolved)
+	}
+	return list
+}
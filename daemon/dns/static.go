@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// SourceStatic is the source of the domains configured statically for an IP.
+// They take precedence over the resolved ones, and never expire.
+const SourceStatic = "static"
+
+// Config holds the DNS section of the configuration: the filter, and the
+// static domains.
+type Config struct {
+	// Filter options not set in the configuration are the ones given on the
+	// command line.
+	Filter
+	// Static are the domains asserted for IPs, with the canonical name first:
+	// {"192.0.2.1": ["nas.lan", "nas"]}
+	Static map[string][]string `json:"Static"`
+}
+
+// UnmarshalJSON decodes the configuration on top of the default filter, and
+// replaces the previous values.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	// without the methods of Config, to not call this method again.
+	type config Config
+	conf := config{Filter: GetDefaultFilter()}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return err
+	}
+	*c = Config(conf)
+	return nil
+}
+
+var (
+	staticIPs  = make(map[string]bool)
+	staticLock = sync.Mutex{}
+)
+
+// SetStatic validates and applies the static domains of the IPs, replacing
+// the previous ones. If they're not valid, the current ones are kept.
+// The records resolved for these IPs are ignored while they're static, and
+// the filter doesn't apply to them.
+func SetStatic(static map[string][]string) error {
+	hosts := make(map[string][]string, len(static))
+	for addr, names := range static {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("Invalid DNS static IP: %s", addr)
+		}
+		list := make([]string, 0, len(names))
+		for _, name := range names {
+			if name = NormalizeHost(name); name != "" && !contains(list, name) {
+				list = append(list, name)
+			}
+		}
+		if len(list) == 0 {
+			return fmt.Errorf("Invalid DNS static IP %s: no domains", addr)
+		}
+		hosts[ip.String()] = list
+	}
+
+	// the callbacks are called after releasing the lock, they may call
+	// back into the package.
+	evicted := make(map[string][]string)
+	var events []Event
+	now := time.Now()
+
+	staticLock.Lock()
+	for resolved := range staticIPs {
+		if _, found := hosts[resolved]; !found {
+			evicted[resolved] = removeEntry(resolved)
+		}
+	}
+	staticIPs = make(map[string]bool, len(hosts))
+	for resolved, list := range hosts {
+		staticIPs[resolved] = true
+		evicted[resolved] = setStatic(resolved, list, now)
+		for _, h := range list {
+			events = append(events, Event{IP: resolved, Host: h, Source: SourceStatic, Time: now})
+		}
+	}
+	staticLock.Unlock()
+
+	for resolved, list := range evicted {
+		notifyEvicted(resolved, list...)
+	}
+	for _, ev := range events {
+		publish(ev)
+	}
+	return nil
+}
+
+// setStatic replaces the entry of an IP with its static domains, and returns
+// the domains it replaced.
+func setStatic(resolved string, hosts []string, now time.Time) (evicted []string) {
+	s := getShard(resolved)
+	s.Lock()
+	defer s.Unlock()
+
+	if e, found := s.entries[resolved]; found {
+		for _, h := range e.hosts {
+			if !contains(hosts, h) {
+				evicted = append(evicted, h)
+			}
+		}
+		unindex(resolved, evicted...)
+	}
+	s.entries[resolved] = &entry{hosts: hosts, lastSeen: now, source: SourceStatic}
+	index(resolved, hosts...)
+	return evicted
+}
+
+func (e *entry) static() bool {
+	return e.source == SourceStatic && e.origin == ""
+}
@@ -0,0 +1,138 @@
+package dns
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSetStatic(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	defer SetStatic(nil)
+
+	if err := SetStatic(map[string][]string{"not-an-ip": {"nas.lan"}}); err == nil {
+		t.Error("SetStatic() invalid IP accepted")
+	}
+	if err := SetStatic(map[string][]string{"192.0.2.230": {""}}); err == nil {
+		t.Error("SetStatic() IP without domains accepted")
+	}
+
+	Track("192.0.2.230", "dynamic.example.com")
+	if err := SetStatic(map[string][]string{"192.0.2.230": {"NAS.lan.", "nas"}, "127.0.0.53": {"resolver.lan"}}); err != nil {
+		t.Fatal("SetStatic() error:", err)
+	}
+
+	t.Run("Test precedence", func(t *testing.T) {
+		if host, found := Host("192.0.2.230"); !found || host != "nas.lan" {
+			t.Error("Host() static domain not returned:", host, found)
+		}
+		skipped := GetStats().StaticSkipped
+		if res := TrackFrom("192.0.2.230", "other.example.com", nil, "A"); res != TrackSkipped {
+			t.Error("TrackFrom() resolved domain of a static IP tracked:", res)
+		}
+		if GetStats().StaticSkipped == skipped {
+			t.Error("TrackFrom() skipped record of a static IP not counted")
+		}
+		e, _ := GetEntry("192.0.2.230")
+		if len(e.Hosts) != 2 || e.Hosts[0] != "nas.lan" || e.Source != SourceStatic {
+			t.Error("GetEntry() static entry modified:", e)
+		}
+		if ips := GetIPsByHost("dynamic.example.com"); len(ips) != 0 {
+			t.Error("GetIPsByHost() replaced domain still indexed:", ips)
+		}
+		if host, found := Host("127.0.0.53"); !found || host != "resolver.lan" {
+			t.Error("Host() static domain of a loopback IP not returned:", host, found)
+		}
+	})
+
+	t.Run("Test never evicted", func(t *testing.T) {
+		setLastSeen("192.0.2.230", time.Now().Add(-2*MaxEntryAge))
+		cleanup(time.Minute)
+		if _, found := Host("192.0.2.230"); !found {
+			t.Error("cleanup() static entry evicted")
+		}
+		if n := Merge(map[string]Entry{"192.0.2.230": {Hosts: []string{"imported.example.com"}, LastSeen: time.Now()}}, "peer"); n != 0 {
+			t.Error("Merge() static entry replaced")
+		}
+	})
+
+	t.Run("Test callbacks", func(t *testing.T) {
+		defer func() { evictCallbacks = nil }()
+		reloaded := false
+		OnEvict(func(resolved, host string) {
+			// the callbacks may call back into the package.
+			if resolved == "192.0.2.233" && !reloaded {
+				reloaded = true
+				SetStatic(map[string][]string{"192.0.2.230": {"nas.lan", "nas"}})
+			}
+		})
+		done := make(chan bool)
+		go func() {
+			SetStatic(map[string][]string{"192.0.2.230": {"nas.lan", "nas"}, "192.0.2.233": {"tv.lan"}})
+			SetStatic(map[string][]string{"192.0.2.230": {"nas.lan", "nas"}})
+			done <- true
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("SetStatic() blocked by a callback")
+		}
+		if !reloaded {
+			t.Error("SetStatic() removed static IP not notified")
+		}
+	})
+
+	t.Run("Test reload", func(t *testing.T) {
+		if err := SetStatic(map[string][]string{"192.0.2.231": {"printer.lan"}}); err != nil {
+			t.Fatal("SetStatic() error:", err)
+		}
+		if _, found := Host("192.0.2.230"); found {
+			t.Error("SetStatic() removed static IP still tracked")
+		}
+		if host, _ := Host("192.0.2.231"); host != "printer.lan" {
+			t.Error("SetStatic() new static IP not tracked:", host)
+		}
+		Track("192.0.2.230", "dynamic.example.com")
+		if host, _ := Host("192.0.2.230"); host != "dynamic.example.com" {
+			t.Error("Track() removed static IP not tracked again:", host)
+		}
+	})
+}
+
+func TestConfigJSON(t *testing.T) {
+	var conf Config
+	raw := `{"TrackLocal": true, "Static": {"192.0.2.232": ["nas.lan"]}}`
+	if err := json.Unmarshal([]byte(raw), &conf); err != nil {
+		t.Fatal("Unmarshal() error:", err)
+	}
+	if !conf.TrackLocal || len(conf.Static["192.0.2.232"]) != 1 {
+		t.Error("Unmarshal() invalid config:", conf)
+	}
+
+	t.Run("Test default filter", func(t *testing.T) {
+		if err := SetDefaultFilter(Filter{TrackLocal: true, Skip: []string{ScopeULA}}); err != nil {
+			t.Fatal("SetDefaultFilter() error:", err)
+		}
+		defer SetDefaultFilter(Filter{})
+
+		conf := &Config{}
+		if err := json.Unmarshal([]byte(`{"Static": {"192.0.2.232": ["nas.lan"]}}`), conf); err != nil {
+			t.Fatal("Unmarshal() error:", err)
+		}
+		if !conf.TrackLocal || len(conf.Skip) != 1 || conf.Skip[0] != ScopeULA {
+			t.Error("Unmarshal() default filter options not kept:", conf.Filter)
+		}
+
+		// the same config is decoded again on reloads.
+		if err := json.Unmarshal([]byte(`{"Skip": ["none"]}`), conf); err != nil {
+			t.Fatal("Unmarshal() error:", err)
+		}
+		if len(conf.Skip) != 1 || conf.Skip[0] != ScopeNone || len(conf.Static) != 0 {
+			t.Error("Unmarshal() invalid reloaded config:", conf)
+		}
+		if f := GetDefaultFilter(); len(f.Skip) != 1 || f.Skip[0] != ScopeULA {
+			t.Error("Unmarshal() default filter modified:", f)
+		}
+	})
+}
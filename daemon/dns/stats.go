@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"sync/atomic"
+)
+
+// Stats holds the counters of the DNS records not tracked.
+type Stats struct {
+	// SkippedLocal is the number of addresses skipped because of their scope.
+	SkippedLocal uint64 `json:"skipped_local"`
+	// Filtered is the number of records discarded by the filter.
+	Filtered uint64 `json:"filtered"`
+	// Excluded is the number of records discarded because the domain was
+	// excluded.
+	Excluded uint64 `json:"excluded"`
+	// Rebindings is the number of possible DNS rebinding attempts.
+	Rebindings uint64 `json:"rebindings"`
+	// LongHosts is the number of domains longer than the maximum length,
+	// rejected or truncated.
+	LongHosts uint64 `json:"long_hosts"`
+	// StaticSkipped is the number of records discarded because their IP has
+	// static domains.
+	StaticSkipped uint64 `json:"static_skipped"`
+	// EmptyHost is the number of records discarded because the domain was empty.
+	EmptyHost uint64 `json:"empty_host"`
+	// DroppedEvents is the number of events discarded because the queue of a
+	// subscriber was full.
+	DroppedEvents uint64 `json:"dropped_events"`
+	// SampledOut is the number of events of refreshed records not delivered
+	// due to sampling.
+	SampledOut uint64 `json:"sampled_out"`
+	// Sampled is true if the events of refreshed records are being sampled.
+	Sampled bool `json:"sampled"`
+	// DiscardedPaused is the number of DNS responses discarded while the
+	// tracking was paused.
+	DiscardedPaused uint64 `json:"discarded_paused"`
+	// Paused is true if the tracking of DNS responses is paused.
+	Paused bool `json:"paused"`
+}
+
+// counters are globals to guarantee the alignment required by the atomic
+// operations on 32 bits platforms.
+var (
+	skippedLocal  uint64
+	filtered      uint64
+	excluded      uint64
+	rebindings    uint64
+	longHosts     uint64
+	staticSkipped uint64
+	emptyHost     uint64
+	droppedEvents uint64
+	sampledOut    uint64
+	sampleCount   uint64
+	discardPaused uint64
+)
+
+// GetStats returns the current counters.
+func GetStats() Stats {
+	return Stats{
+		SkippedLocal:    atomic.LoadUint64(&skippedLocal),
+		Filtered:        atomic.LoadUint64(&filtered),
+		Excluded:        atomic.LoadUint64(&excluded),
+		Rebindings:      atomic.LoadUint64(&rebindings),
+		LongHosts:       atomic.LoadUint64(&longHosts),
+		StaticSkipped:   atomic.LoadUint64(&staticSkipped),
+		EmptyHost:       atomic.LoadUint64(&emptyHost),
+		DroppedEvents:   atomic.LoadUint64(&droppedEvents),
+		SampledOut:      atomic.LoadUint64(&sampledOut),
+		Sampled:         Sampled(),
+		DiscardedPaused: atomic.LoadUint64(&discardPaused),
+		Paused:          Paused(),
+	}
+}
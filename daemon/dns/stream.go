@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/evilsocket/opensnitch/daemon/log"
+)
+
+const (
+	// number of events queued for a client before start discarding them.
+	streamQueueSize = 256
+	// time to wait for a client to read an event before disconnecting it.
+	streamWriteTimeout = 2 * time.Second
+)
+
+// StreamEvents listens on a Unix socket, with the given permissions, and
+// streams the tracked records to the connected clients, one JSON object per
+// line, until the context is cancelled.
+// Slow clients never block the tracking of records: their events are
+// discarded if their queue is full, and they're disconnected if they don't
+// read them.
+// A stale socket at the path is replaced, but any other file is an error.
+func StreamEvents(ctx context.Context, path string, perm os.FileMode) error {
+	if st, err := os.Lstat(path); err == nil {
+		if st.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		listener.Close()
+		return err
+	}
+	log.Info("Streaming DNS records on %s", path)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warning("DNS records stream, accept error: %s", err)
+				}
+				return
+			}
+			go streamToClient(ctx, conn)
+		}
+	}()
+
+	return nil
+}
+
+func streamToClient(ctx context.Context, conn net.Conn) {
+	events, unsubscribe := Subscribe(streamQueueSize)
+	defer unsubscribe()
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := enc.Encode(ev); err != nil {
+				log.Debug("DNS records stream, client disconnected: %s", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStreamEventsNotSocket(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ostest_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	path := filepath.Join(tmpDir, "dns.sock")
+	ioutil.WriteFile(path, []byte("data"), 0644)
+
+	if err := StreamEvents(context.Background(), path, 0600); err == nil {
+		t.Error("StreamEvents() regular file replaced")
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "data" {
+		t.Error("StreamEvents() regular file modified:", string(data), err)
+	}
+
+	stalePath := filepath.Join(tmpDir, "stale.sock")
+	l, err := net.Listen("unix", stalePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StreamEvents(ctx, stalePath, 0600); err != nil {
+		t.Error("StreamEvents() stale socket not replaced:", err)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	tmpDir, err := ioutil.TempDir("", "ostest_dns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	sockPath := filepath.Join(tmpDir, "dns.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := StreamEvents(ctx, sockPath, 0600); err != nil {
+		t.Fatal("StreamEvents() error:", err)
+	}
+	if st, err := os.Stat(sockPath); err != nil || st.Mode().Perm() != 0600 {
+		t.Error("StreamEvents() invalid socket permissions:", st, err)
+	}
+
+	subscribed := numSubscribers()
+	conn, err := net.Dial("unix", sockPath)
+	if err != nil {
+		t.Fatal("StreamEvents() unable to connect:", err)
+	}
+	defer conn.Close()
+
+	// wait for the client to be subscribed, other tests may have left
+	// subscribers behind.
+	for i := 0; i < 100 && numSubscribers() <= subscribed; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Track("203.0.113.10", "stream.example.com")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatal("StreamEvents() error reading event:", err)
+	}
+	var ev Event
+	if err := json.Unmarshal(line, &ev); err != nil {
+		t.Fatal("StreamEvents() invalid event:", err, string(line))
+	}
+	if ev.IP != "203.0.113.10" || ev.Host != "stream.example.com" {
+		t.Error("StreamEvents() unexpected event:", ev)
+	}
+}
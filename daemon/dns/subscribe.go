@@ -0,0 +1,92 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event holds a tracked DNS record.
+type Event struct {
+	IP     string    `json:"ip"`
+	Host   string    `json:"host"`
+	Server string    `json:"server,omitempty"`
+	Source string    `json:"source,omitempty"`
+	Time   time.Time `json:"time"`
+	// Rebinding is true if the domain used to resolve to public IPs, and
+	// the IP is private.
+	Rebinding bool `json:"rebinding,omitempty"`
+}
+
+var (
+	subscribers = make(map[chan Event]bool)
+	subsLock    = sync.RWMutex{}
+)
+
+// Subscribe returns a channel where every tracked record is sent, and a
+// function to unsubscribe from it.
+// Tracking never blocks on subscribers: events are discarded if the channel
+// buffer is full.
+func Subscribe(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+
+	subsLock.Lock()
+	subscribers[ch] = true
+	subsLock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			subsLock.Lock()
+			delete(subscribers, ch)
+			subsLock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func publish(ev Event) {
+	subsLock.RLock()
+	defer subsLock.RUnlock()
+
+	for ch := range subscribers {
+		select {
+		case ch <- ev:
+		default:
+			atomic.AddUint64(&droppedEvents, 1)
+		}
+	}
+}
+
+// WaitForHost returns the domain of an IP, as Host() does. If it's not tracked
+// yet, it waits until it's tracked, the timeout expires or the context is
+// cancelled.
+// It's useful for connections evaluated before the DNS response that resolved
+// its IP has been tracked.
+func WaitForHost(ctx context.Context, ip string, timeout time.Duration) (host string, ok bool) {
+	events, unsubscribe := Subscribe(8)
+	defer unsubscribe()
+
+	if host, ok = Host(ip); ok {
+		return host, ok
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ev := <-events:
+			// the domain of the event may not be the preferred one of the
+			// IP, as a reverse one.
+			if ev.IP == ip {
+				return Host(ip)
+			}
+		case <-timer.C:
+			// the event may have been discarded if there were too many.
+			return Host(ip)
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitForHost(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Test already tracked", func(t *testing.T) {
+		Track("93.184.216.34", "example.com")
+		host, ok := WaitForHost(ctx, "93.184.216.34", time.Second)
+		if !ok || host != "example.com" {
+			t.Error("WaitForHost() tracked host not found:", host, ok)
+		}
+	})
+
+	t.Run("Test tracked while waiting", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			Track("93.184.216.35", "example.org")
+		}()
+		host, ok := WaitForHost(ctx, "93.184.216.35", 5*time.Second)
+		if !ok || host != "example.org" {
+			t.Error("WaitForHost() host tracked while waiting not found:", host, ok)
+		}
+	})
+
+	t.Run("Test timeout", func(t *testing.T) {
+		start := time.Now()
+		host, ok := WaitForHost(ctx, "93.184.216.36", 50*time.Millisecond)
+		if ok {
+			t.Error("WaitForHost() untracked host found:", host)
+		}
+		if time.Since(start) < 50*time.Millisecond {
+			t.Error("WaitForHost() returned before the timeout")
+		}
+	})
+
+	t.Run("Test context cancelled", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if host, ok := WaitForHost(cctx, "93.184.216.37", 5*time.Second); ok {
+			t.Error("WaitForHost() untracked host found:", host)
+		}
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	events, unsubscribe := Subscribe(1)
+	Track("93.184.216.40", "example.net")
+	// the buffer is full, this event must be discarded without blocking.
+	Track("93.184.216.41", "example.net")
+
+	ev := <-events
+	if ev.IP != "93.184.216.40" || ev.Host != "example.net" {
+		t.Error("Subscribe() invalid event:", ev)
+	}
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("Subscribe() channel not closed after unsubscribing")
+	}
+}
+
+func numSubscribers() int {
+	subsLock.RLock()
+	defer subsLock.RUnlock()
+	return len(subscribers)
+}
@@ -1,8 +1,11 @@
 package dns
 
 import (
+	"context"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/evilsocket/opensnitch/daemon/log"
 
@@ -10,9 +13,90 @@ import (
 	"github.com/google/gopacket/layers"
 )
 
+// entry holds the domains resolved to an IP, and the last time it was seen in
+// a response.
+type entry struct {
+	// hosts are sorted from the most to the least recently seen.
+	hosts    []string
+	lastSeen time.Time
+	// server is the nameserver that answered the query, if known.
+	server string
+	// bypassed is true if server is not one of the system nameservers.
+	bypassed bool
+	// source is how the domain was obtained.
+	source string
+	// resolved is the number of times the IP has been tracked.
+	resolved uint64
+	// connections is the number of connections made to the IP.
+	connections uint64
+	// origin is the instance the entry was imported from, empty if it was
+	// tracked locally.
+	origin string
+	// reverse are the domains only obtained with reverse lookups (PTR), which
+	// are controlled by the owner of the IP and less reliable than the
+	// forward ones.
+	reverse map[string]bool
+	// local are the domains loaded from the hosts file, which are never
+	// evicted, even if the IP is resolved by DNS too.
+	local map[string]bool
+	// pinnedUntil is the time until which the entry is kept after expiring,
+	// because it's referenced by a rule.
+	pinnedUntil time.Time
+	// geo is the GeoIP/ASN information of the IP, if it has been looked up.
+	geo *GeoInfo
+}
+
+// Entry holds the information of a tracked IP.
+type Entry struct {
+	// Hosts are sorted from the most to the least recently seen, with the
+	// forward domains first if PreferForward is set.
+	Hosts    []string  `json:"hosts"`
+	LastSeen time.Time `json:"last_seen"`
+	Server   string    `json:"server,omitempty"`
+	Bypassed bool      `json:"bypassed,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	// Resolved is the number of times the IP has been tracked.
+	Resolved uint64 `json:"resolved"`
+	// Connections is the number of connections made to the IP.
+	Connections uint64 `json:"connections"`
+	// Origin is the instance the entry was imported from, empty if it was
+	// tracked locally.
+	Origin string `json:"origin,omitempty"`
+	// LowTrust is true if the first domain was only obtained with a reverse
+	// lookup.
+	LowTrust bool `json:"low_trust,omitempty"`
+	// Geo is the GeoIP/ASN information of the IP, if it has been looked up.
+	Geo *GeoInfo `json:"geo,omitempty"`
+}
+
 var (
-	responses = make(map[string]string, 0)
-	lock      = sync.RWMutex{}
+	// MaxEntryAge is the time an entry stays in the cache after the last time
+	// it was seen in a DNS response.
+	MaxEntryAge = 6 * time.Hour
+
+	// MaxHostsPerIP is the maximum number of domains kept for an IP.
+	// When exceeded, the least recently seen domains are removed.
+	MaxHostsPerIP = 32
+
+	// PreferForward returns the domains resolved by forward lookups
+	// (A, AAAA, CNAME) before the ones obtained with reverse lookups (PTR),
+	// even if these were seen more recently.
+	PreferForward = true
+
+	// MatchQueried returns the domain queried by the application instead of
+	// its canonical name, when the response had CNAMEs:
+	// cdn.example.com CNAME example.map.fastly.net
+	// Rules written for the domains the user knows work as expected, but a
+	// domain can point to any canonical name. Matching the canonical name is
+	// closer to the real destination, but it often changes and is shared by
+	// unrelated domains of the same CDN.
+	MatchQueried = true
+
+	// paused is 1 while the tracking of DNS responses is paused.
+	paused int32
+	// pauseGate is held by TrackAnswers() while a response is tracked, so
+	// Pause() can wait for the ones in flight.
+	pauseGate = sync.RWMutex{}
 )
 
 // TrackAnswers obtains the resolved domains of a DNS query.
@@ -40,60 +124,695 @@ func TrackAnswers(packet gopacket.Packet) bool {
 	if ok == false || dnsAns == nil {
 		return false
 	}
+	pauseGate.RLock()
+	defer pauseGate.RUnlock()
+	if Paused() {
+		atomic.AddUint64(&discardPaused, 1)
+		return true
+	}
 
+	var server net.IP
+	if netLayer := packet.NetworkLayer(); netLayer != nil {
+		server = net.IP(netLayer.NetworkFlow().Src().Raw())
+	}
+
+	track := trackRecord
+	if Lazy() {
+		// the records are only kept, until a connection needs them.
+		track = keepRecord
+	}
+	rec := newRecentResponse(dnsAns.Contents, server)
 	for _, ans := range dnsAns.Answers {
-		if ans.Name != nil {
-			if ans.IP != nil {
-				Track(ans.IP.String(), string(ans.Name))
-			} else if ans.CNAME != nil {
-				Track(string(ans.CNAME), string(ans.Name))
-			}
+		rec.add(&ans, track(&ans, server))
+	}
+	// the IPs of SRV and MX targets are usually sent as additional records.
+	for _, ans := range dnsAns.Additionals {
+		if ans.IP != nil {
+			rec.add(&ans, track(&ans, server))
 		}
 	}
+	rec.save()
 
 	return true
 }
 
+func trackRecord(ans *layers.DNSResourceRecord, server net.IP) TrackResult {
+	value := recordValue(ans)
+	if ans.Name == nil || value == "" {
+		return TrackSkipped
+	}
+	return TrackFrom(value, string(ans.Name), server, ans.Type.String())
+}
+
+// recordValue returns what a record resolves its name to, or an empty string
+// if it's not tracked.
+func recordValue(ans *layers.DNSResourceRecord) string {
+	switch {
+	case ans.IP != nil:
+		return ans.IP.String()
+	case ans.CNAME != nil:
+		return NormalizeHost(string(ans.CNAME))
+	case ans.Type == layers.DNSTypeSRV:
+		// the target is the host the application will connect to
+		// _xmpp-client._tcp.example.com -> xmpp.example.com
+		return NormalizeHost(string(ans.SRV.Name))
+	case ans.Type == layers.DNSTypeMX:
+		return NormalizeHost(string(ans.MX.Name))
+	}
+	return ""
+}
+
+// Pause stops tracking the DNS responses until Resume() is called.
+// The responses are still recognized by TrackAnswers(), but discarded.
+// It returns once the responses being tracked have been tracked, so no
+// response is tracked after it returns. For that reason it must not be called
+// from the OnEvict() callbacks.
+func Pause() {
+	atomic.StoreInt32(&paused, 1)
+	pauseGate.Lock()
+	pauseGate.Unlock()
+	log.Info("DNS tracking paused")
+}
+
+// Resume starts tracking again the DNS responses.
+func Resume() {
+	atomic.StoreInt32(&paused, 0)
+	log.Info("DNS tracking resumed")
+}
+
+// Paused returns if the tracking of DNS responses is paused.
+func Paused() bool {
+	return atomic.LoadInt32(&paused) == 1
+}
+
+// TrackResult describes how the list was modified by a tracked record.
+type TrackResult int
+
+// Results of tracking a record.
+const (
+	// TrackSkipped means that the record was discarded.
+	TrackSkipped TrackResult = iota
+	// TrackNew means that the IP was not in the list.
+	TrackNew
+	// TrackRefreshed means that the IP was already resolved to the domain.
+	TrackRefreshed
+	// TrackChanged means that the IP was resolved to a different domain.
+	TrackChanged
+)
+
+func (r TrackResult) String() string {
+	switch r {
+	case TrackNew:
+		return "new"
+	case TrackRefreshed:
+		return "refreshed"
+	case TrackChanged:
+		return "changed"
+	}
+	return "skipped"
+}
+
 // Track adds a resolved domain to the list.
-func Track(resolved string, hostname string) {
-	lock.Lock()
-	defer lock.Unlock()
+func Track(resolved string, hostname string) TrackResult {
+	return TrackFrom(resolved, hostname, nil, "")
+}
 
-	if resolved == "127.0.0.1" {
-		return
+// TrackFrom adds a resolved domain to the list, along with the nameserver
+// that resolved it, and the source of the record (the type of the DNS record
+// for example).
+// Domains resolved by a nameserver other than the configured in the system are
+// flagged as bypassed.
+func TrackFrom(resolved string, hostname string, server net.IP, source string) TrackResult {
+	srvAddr := ""
+	bypassed := false
+	if server != nil {
+		srvAddr = server.String()
+		bypassed = !IsSystemResolver(server)
 	}
-	responses[resolved] = hostname
 
-	log.Debug("New DNS record: %s -> %s", resolved, hostname)
+	f := getFilter()
+	hostname = NormalizeHost(hostname)
+	if hostname != "" {
+		if hostname = f.limitHost(hostname); hostname == "" {
+			return TrackSkipped
+		}
+	}
+	rebinding := hostname != "" && f.Rebinding != RebindingIgnore && isRebinding(resolved, hostname)
+	if rebinding {
+		atomic.AddUint64(&rebindings, 1)
+		log.Warning("Possible DNS rebinding attempt: %s, which resolved to public IPs, now resolves to %s", hostname, resolved)
+		if f.Rebinding == RebindingDrop {
+			return TrackSkipped
+		}
+	}
+	if !f.acceptIP(resolved) {
+		return TrackSkipped
+	}
+	if hostname == "" {
+		// root domain, or a failed capture.
+		atomic.AddUint64(&emptyHost, 1)
+		return TrackSkipped
+	}
+	if !f.acceptHost(hostname) {
+		return TrackSkipped
+	}
+
+	var evicted []string
+	var changes []ChangeEvent
+	watchChanges := watchingChanges()
+	now := time.Now()
+	if watchChanges {
+		if ch, changed := ipsChange(resolved, hostname, now); changed {
+			changes = append(changes, ch)
+		}
+	}
+	s := getShard(resolved)
+	s.Lock()
+	result := TrackNew
+	prevHost := ""
+	e, found := s.entries[resolved]
+	if found && e.static() {
+		s.Unlock()
+		atomic.AddUint64(&staticSkipped, 1)
+		return TrackSkipped
+	}
+	if !found || e.expired(now) {
+		if found {
+			evicted = e.hosts
+			unindex(resolved, e.hosts...)
+		}
+		e = &entry{}
+		s.entries[resolved] = e
+	} else {
+		prevHost = e.host()
+		result = TrackChanged
+		if prevHost == hostname {
+			result = TrackRefreshed
+		}
+	}
+	e.setTrust(hostname, source)
+	removed := e.addHost(hostname)
+	unindex(resolved, removed...)
+	index(resolved, hostname)
+	if newHost := e.host(); watchChanges && prevHost != "" && prevHost != newHost {
+		changes = append(changes, ChangeEvent{Kind: ChangeHost, IP: resolved, OldHost: prevHost, NewHost: newHost, Time: now})
+	}
+	evicted = append(evicted, removed...)
+	e.lastSeen = now
+	e.server = srvAddr
+	e.bypassed = bypassed
+	e.source = source
+	e.origin = ""
+	e.resolved++
+	s.Unlock()
+
+	notifyEvicted(resolved, evicted...)
+	for _, ch := range changes {
+		publishChange(ch)
+	}
+	if result == TrackRefreshed && f.sampleOut() {
+		return result
+	}
+	publish(Event{IP: resolved, Host: hostname, Server: srvAddr, Source: source, Time: now, Rebinding: rebinding})
+
+	if bypassed {
+		log.Debug("New DNS record (%s, %s): %s -> %s (resolved by non-system nameserver %s)", source, result, resolved, hostname, srvAddr)
+		return result
+	}
+	log.Debug("New DNS record (%s, %s): %s -> %s", source, result, resolved, hostname)
+	return result
+}
+
+// isRebinding checks if a domain that was resolved to public IPs is now
+// resolved to a private one.
+func isRebinding(resolved, hostname string) bool {
+	ip := net.ParseIP(resolved)
+	if ip == nil || !isPrivate(ip) {
+		return false
+	}
+	now := time.Now()
+
+	for _, prev := range indexed(hostname) {
+		if _, found := alive(prev, now); !found {
+			continue
+		}
+		if prevIP := net.ParseIP(prev); prevIP != nil && !isPrivate(prevIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// CountConnection increments the number of connections made to an IP, if
+// it's tracked.
+func CountConnection(resolved string) {
+	s := getShard(resolved)
+	s.Lock()
+	defer s.Unlock()
+
+	if e, found := s.entries[resolved]; found {
+		e.connections++
+	}
 }
 
 // Host returns if a resolved domain is in the list.
 func Host(resolved string) (host string, found bool) {
-	lock.RLock()
-	defer lock.RUnlock()
+	s := getShard(resolved)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[resolved]
+	if !found || e.expired(time.Now()) {
+		return "", false
+	}
+	return e.host(), true
+}
+
+// HostTrust returns the domain of an IP, and if it was only obtained with a
+// reverse lookup, in which case it shouldn't be trusted for sensitive
+// decisions.
+func HostTrust(resolved string) (host string, lowTrust bool, found bool) {
+	s := getShard(resolved)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[resolved]
+	if !found || e.expired(time.Now()) {
+		return "", false, false
+	}
+	host = e.host()
+	return host, e.reverse[host], true
+}
+
+// GetEntry returns the information of a tracked IP.
+func GetEntry(resolved string) (Entry, bool) {
+	s := getShard(resolved)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[resolved]
+	if !found || e.expired(time.Now()) {
+		return Entry{}, false
+	}
+	return e.export(), true
+}
+
+// Snapshot returns a copy of all the tracked IPs, at a single point in time,
+// so the aliases (CNAMEs) and their IPs are consistent.
+// It's O(n) and blocks the tracking of every part of the list while it's
+// copied, so it's meant for periodic exports, not to be used on every
+// connection.
+func Snapshot() map[string]Entry {
+	now := time.Now()
+	snapshot := make(map[string]Entry)
+	forEachEntryAtOnce(func(resolved string, e *entry) {
+		if !e.expired(now) {
+			snapshot[resolved] = e.export()
+		}
+	})
+	return snapshot
+}
+
+// Hosts returns the domains resolved to an IP, from the most to the least
+// recently seen.
+func Hosts(resolved string) []string {
+	s := getShard(resolved)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[resolved]
+	if !found || e.expired(time.Now()) {
+		return nil
+	}
+	return e.sortedHosts()
+}
+
+// GetResolver returns the nameserver that resolved the domain of an IP, and if
+// it's not one of the system nameservers.
+// The server is empty if it's unknown.
+func GetResolver(resolved string) (server string, bypassed bool, found bool) {
+	s := getShard(resolved)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[resolved]
+	if !found || e.expired(time.Now()) {
+		return "", false, false
+	}
+	return e.server, e.bypassed, true
+}
+
+// GetFreshestHost returns the most recently resolved domain of an IP, the
+// time elapsed since it was last seen in a DNS response, and if it was only
+// obtained with a reverse lookup. Unlike Host(), it doesn't prefer the forward
+// domains.
+func GetFreshestHost(ip string) (host string, age time.Duration, lowTrust bool, ok bool) {
+	s := getShard(ip)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[ip]
+	if !found {
+		return "", 0, false, false
+	}
+	now := time.Now()
+	if e.expired(now) {
+		return "", 0, false, false
+	}
+	host = e.hosts[0]
+	return host, now.Sub(e.lastSeen), e.reverse[host], true
+}
+
+// IsTracked returns if an IP is in the list, and the time elapsed since it was
+// last seen in a DNS response.
+func IsTracked(ip string) (age time.Duration, ok bool) {
+	s := getShard(ip)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[ip]
+	if !found {
+		return 0, false
+	}
+	now := time.Now()
+	if e.expired(now) {
+		return 0, false
+	}
+	return now.Sub(e.lastSeen), true
+}
+
+// GetHostByIPNet returns the domain of an IP, or if it's not in the list,
+// the most recently resolved domain of an IP in the same network, given by
+// the prefix length.
+// Matching by network requires to iterate over the whole list.
+func GetHostByIPNet(ip string, prefixLen int) (host string, found bool) {
+	if host, found = Host(ip); found {
+		return host, found
+	}
+	netIP := net.ParseIP(ip)
+	if netIP == nil {
+		return "", false
+	}
+	bits := 128
+	if netIP.To4() != nil {
+		netIP = netIP.To4()
+		bits = 32
+	}
+	mask := net.CIDRMask(prefixLen, bits)
+	if mask == nil {
+		return "", false
+	}
+	ipNet := net.IPNet{IP: netIP.Mask(mask), Mask: mask}
+
+	now := time.Now()
+	var lastSeen time.Time
+	forEachEntry(func(resolved string, e *entry) {
+		if e.expired(now) || (found && e.lastSeen.Before(lastSeen)) {
+			return
+		}
+		if resIP := net.ParseIP(resolved); resIP != nil && ipNet.Contains(resIP) {
+			host, lastSeen, found = e.host(), e.lastSeen, true
+		}
+	})
+	return host, found
+}
+
+// GetIPsByHost returns the IPs a domain has been resolved to, directly or
+// through its canonical names.
+func GetIPsByHost(host string) []string {
+	host = NormalizeHost(host)
+	now := time.Now()
+
+	var ips []string
+	seen := map[string]bool{host: true}
+	pending := []string{host}
+	for len(pending) > 0 {
+		host, pending = pending[0], pending[1:]
+		for _, resolved := range indexed(host) {
+			if seen[resolved] {
+				continue
+			}
+			source, found := alive(resolved, now)
+			if !found {
+				continue
+			}
+			seen[resolved] = true
+			if net.ParseIP(resolved) != nil {
+				ips = append(ips, resolved)
+			} else if source != layers.DNSTypeSRV.String() && source != layers.DNSTypeMX.String() {
+				pending = append(pending, resolved)
+			}
+		}
+	}
+	return ips
+}
 
-	host, found = responses[resolved]
-	return
+// Names returns the domain queried by the application that resolved an IP,
+// and its canonical name. They're the same if there were no CNAMEs.
+func Names(resolved string) (queried string, canonical string, found bool) {
+	canonical, found = Host(resolved)
+	if !found {
+		return "", "", false
+	}
+	// host might have been CNAME; go back until we reach the "root"
+	queried = canonical
+	seen := make(map[string]bool) // prevent possibility of loops
+	for {
+		orig, had := aliasOf(queried)
+		if seen[orig] {
+			break
+		}
+		if !had {
+			break
+		}
+		seen[orig] = true
+		queried = orig
+	}
+	return queried, canonical, true
 }
 
 // HostOr checks if an IP has a domain name already resolved.
 // If the domain is in the list it's returned, otherwise the IP will be returned.
+// The domain is the queried or the canonical one, depending on MatchQueried.
+// In lazy mode, the domain is tracked from the records kept if it's not in the
+// list.
 func HostOr(ip net.IP, or string) string {
-	if host, found := Host(ip.String()); found == true {
-		// host might have been CNAME; go back until we reach the "root"
-		seen := make(map[string]bool) // prevent possibility of loops
-		for {
-			orig, had := Host(host)
-			if seen[orig] {
-				break
+	queried, canonical, found := Names(ip.String())
+	if !found && Lazy() && resolveLazy(ip.String()) {
+		queried, canonical, found = Names(ip.String())
+	}
+	if found == true {
+		if MatchQueried {
+			return queried
+		}
+		return canonical
+	}
+	return or
+}
+
+// aliasOf returns the domain a canonical name was resolved from.
+// SRV and MX targets are not followed, because the service domain is not the
+// host the application connects to.
+func aliasOf(cname string) (host string, found bool) {
+	s := getShard(cname)
+	s.RLock()
+	defer s.RUnlock()
+
+	e, found := s.entries[cname]
+	if !found || e.expired(time.Now()) {
+		return "", false
+	}
+	if e.source != layers.DNSTypeSRV.String() && e.source != layers.DNSTypeMX.String() {
+		return e.host(), true
+	}
+	return "", false
+}
+
+// CacheCleanerTask removes periodically the entries not seen in the last
+// MaxEntryAge, until the context is cancelled.
+// If the interval is not positive the cleanup is disabled: expired entries
+// are still ignored by the lookups, but they're kept in memory.
+func CacheCleanerTask(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Warning("DNS cache cleanup disabled, interval: %s", interval)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cleanup(interval)
+		}
+	}
+}
+
+// cleanup removes the expired entries, and extends the ones that are pinned and
+// would expire before the next cleanup, after the given interval.
+func cleanup(interval time.Duration) {
+	now := time.Now()
+	pinned := pinnedEntries(now.Add(interval))
+
+	evicted := make(map[string][]string)
+	for _, s := range shards {
+		s.Lock()
+		for resolved, e := range s.entries {
+			if pinned[resolved] {
+				if until := e.lastSeen.Add(MaxEntryAge + PinGracePeriod); until.After(e.pinnedUntil) {
+					e.pinnedUntil = until
+				}
 			}
-			if !had {
-				break
+			if e.expired(now) {
+				evicted[resolved] = e.hosts
+				delete(s.entries, resolved)
+				unindex(resolved, e.hosts...)
+			} else if e.hostsFile() && e.source != SourceHosts && e.stale(now) {
+				// the resolved domains expired, keep the hosts file ones.
+				removed := e.keepLocal()
+				evicted[resolved] = removed
+				unindex(resolved, removed...)
 			}
-			seen[orig] = true
-			host = orig
 		}
-		return host
+		s.Unlock()
 	}
-	return or
+
+	for resolved, hosts := range evicted {
+		notifyEvicted(resolved, hosts...)
+	}
+}
+
+// export returns a copy of the entry.
+// It must be called with the lock of its shard held.
+func (e *entry) export() Entry {
+	hosts := e.sortedHosts()
+	return Entry{
+		Hosts:       hosts,
+		LastSeen:    e.lastSeen,
+		Server:      e.server,
+		Bypassed:    e.bypassed,
+		Source:      e.source,
+		Resolved:    e.resolved,
+		Connections: e.connections,
+		Origin:      e.origin,
+		LowTrust:    e.reverse[hosts[0]],
+		Geo:         e.geo,
+	}
+}
+
+// host returns the most recently seen domain, or the most recently seen
+// forward domain if PreferForward is set.
+func (e *entry) host() string {
+	if PreferForward && len(e.reverse) > 0 {
+		for _, h := range e.hosts {
+			if !e.reverse[h] {
+				return h
+			}
+		}
+	}
+	return e.hosts[0]
+}
+
+// sortedHosts returns a copy of the domains, from the most to the least
+// recently seen, with the forward ones first if PreferForward is set.
+func (e *entry) sortedHosts() []string {
+	hosts := make([]string, 0, len(e.hosts))
+	if !PreferForward || len(e.reverse) == 0 {
+		return append(hosts, e.hosts...)
+	}
+	for _, h := range e.hosts {
+		if !e.reverse[h] {
+			hosts = append(hosts, h)
+		}
+	}
+	for _, h := range e.hosts {
+		if e.reverse[h] {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// setTrust flags a domain as obtained with a reverse lookup, unless it has
+// already been resolved by a forward one.
+// It must be called before adding the domain.
+func (e *entry) setTrust(hostname, source string) {
+	if source != layers.DNSTypePTR.String() {
+		delete(e.reverse, hostname)
+		return
+	}
+	if contains(e.hosts, hostname) && !e.reverse[hostname] {
+		return
+	}
+	if e.reverse == nil {
+		e.reverse = make(map[string]bool)
+	}
+	e.reverse[hostname] = true
+}
+
+// addHost places a domain first in the list of domains, removing the least
+// recently seen ones if there're more than MaxHostsPerIP.
+// It returns the removed domains.
+func (e *entry) addHost(hostname string) (evicted []string) {
+	for i, h := range e.hosts {
+		if h == hostname {
+			e.hosts = append(e.hosts[:i], e.hosts[i+1:]...)
+			break
+		}
+	}
+	e.hosts = append([]string{hostname}, e.hosts...)
+	if MaxHostsPerIP > 0 && len(e.hosts) > MaxHostsPerIP {
+		// the hosts file domains are kept, even over the limit.
+		hosts := make([]string, 0, MaxHostsPerIP)
+		for _, h := range e.hosts {
+			if len(hosts) < MaxHostsPerIP || e.local[h] {
+				hosts = append(hosts, h)
+				continue
+			}
+			evicted = append(evicted, h)
+			delete(e.reverse, h)
+		}
+		e.hosts = hosts
+	}
+	return evicted
+}
+
+// keepLocal removes the domains not loaded from the hosts file, and returns
+// them.
+func (e *entry) keepLocal() (removed []string) {
+	hosts := make([]string, 0, len(e.local))
+	for _, h := range e.hosts {
+		if e.local[h] {
+			hosts = append(hosts, h)
+			continue
+		}
+		removed = append(removed, h)
+		delete(e.reverse, h)
+	}
+	e.hosts = hosts
+	e.source = SourceHosts
+	e.server = ""
+	e.bypassed = false
+	return removed
+}
+
+// hostsFile checks if the entry has domains loaded from the hosts file.
+func (e *entry) hostsFile() bool {
+	return e.origin == "" && len(e.local) > 0
+}
+
+func (e *entry) expired(now time.Time) bool {
+	// imported hosts file entries expire, the origin may have removed them.
+	if e.hostsFile() || e.static() {
+		return false
+	}
+	return e.stale(now)
+}
+
+// stale checks if the entry has not been seen in the last MaxEntryAge, and
+// it's not pinned.
+func (e *entry) stale(now time.Time) bool {
+	return now.Sub(e.lastSeen) > MaxEntryAge && !now.Before(e.pinnedUntil)
 }
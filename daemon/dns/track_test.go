@@ -0,0 +1,771 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// setLastSeen changes the last time an IP was seen, to test its expiration.
+func setLastSeen(resolved string, lastSeen time.Time) {
+	s := getShard(resolved)
+	s.Lock()
+	s.entries[resolved].lastSeen = lastSeen
+	s.Unlock()
+}
+
+func TestGetFreshestHost(t *testing.T) {
+	ip := "185.199.110.153"
+
+	if _, _, _, ok := GetFreshestHost(ip); ok {
+		t.Error("GetFreshestHost() should not find an untracked IP")
+	}
+
+	Track(ip, "github.io")
+	setLastSeen(ip, time.Now().Add(-10*time.Minute))
+
+	t.Run("Test old entry", func(t *testing.T) {
+		host, age, _, ok := GetFreshestHost(ip)
+		if !ok || host != "github.io" {
+			t.Error("GetFreshestHost() host not found:", host, ok)
+		}
+		if age < 10*time.Minute {
+			t.Error("GetFreshestHost() invalid age of an old entry:", age)
+		}
+	})
+
+	Track(ip, "opensnitch.github.io")
+	t.Run("Test new entry", func(t *testing.T) {
+		host, age, _, ok := GetFreshestHost(ip)
+		if !ok || host != "opensnitch.github.io" {
+			t.Error("GetFreshestHost() should return the latest host:", host, ok)
+		}
+		if age > time.Minute {
+			t.Error("GetFreshestHost() invalid age of a new entry:", age)
+		}
+	})
+
+	TrackFrom(ip, "reverse.github.io", nil, "PTR")
+	t.Run("Test reverse entry", func(t *testing.T) {
+		host, _, lowTrust, ok := GetFreshestHost(ip)
+		if !ok || host != "reverse.github.io" || !lowTrust {
+			t.Error("GetFreshestHost() should return the latest reverse host:", host, lowTrust, ok)
+		}
+		if host, _ := Host(ip); host != "opensnitch.github.io" {
+			t.Error("Host() should prefer the forward host:", host)
+		}
+	})
+
+	setLastSeen(ip, time.Now().Add(-MaxEntryAge-time.Second))
+	t.Run("Test expired entry", func(t *testing.T) {
+		if _, _, _, ok := GetFreshestHost(ip); ok {
+			t.Error("GetFreshestHost() should not return expired entries")
+		}
+	})
+}
+
+func TestIsTracked(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	ip := "198.51.100.110"
+
+	t.Run("Test absent", func(t *testing.T) {
+		if _, ok := IsTracked(ip); ok {
+			t.Error("IsTracked() untracked IP found")
+		}
+	})
+
+	Track(ip, "tracked.example.com")
+	t.Run("Test fresh", func(t *testing.T) {
+		if age, ok := IsTracked(ip); !ok || age > time.Minute {
+			t.Error("IsTracked() invalid fresh entry:", age, ok)
+		}
+	})
+
+	setLastSeen(ip, time.Now().Add(-time.Hour))
+	t.Run("Test stale", func(t *testing.T) {
+		if age, ok := IsTracked(ip); !ok || age < time.Hour {
+			t.Error("IsTracked() invalid stale entry:", age, ok)
+		}
+	})
+
+	setLastSeen(ip, time.Now().Add(-MaxEntryAge-time.Second))
+	t.Run("Test expired", func(t *testing.T) {
+		if _, ok := IsTracked(ip); ok {
+			t.Error("IsTracked() expired entry found")
+		}
+	})
+}
+
+func TestCacheCleanerTaskDisabled(t *testing.T) {
+	done := make(chan bool)
+	go func() {
+		CacheCleanerTask(context.Background(), 0)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("CacheCleanerTask() not disabled with a zero interval")
+	}
+}
+
+func TestGetHostByIPNet(t *testing.T) {
+	Track("151.101.1.69", "stackoverflow.com")
+	Track("2a04:4e42::69", "stackexchange.com")
+
+	t.Run("Test exact match", func(t *testing.T) {
+		if host, found := GetHostByIPNet("151.101.1.69", 32); !found || host != "stackoverflow.com" {
+			t.Error("GetHostByIPNet() exact IPv4 not found:", host, found)
+		}
+	})
+	t.Run("Test IPv4 network", func(t *testing.T) {
+		if host, found := GetHostByIPNet("151.101.1.70", 24); !found || host != "stackoverflow.com" {
+			t.Error("GetHostByIPNet() IPv4 network not found:", host, found)
+		}
+		if host, found := GetHostByIPNet("151.101.2.70", 24); found {
+			t.Error("GetHostByIPNet() IPv4 out of network found:", host)
+		}
+	})
+	t.Run("Test IPv6 network", func(t *testing.T) {
+		if host, found := GetHostByIPNet("2a04:4e42::70", 64); !found || host != "stackexchange.com" {
+			t.Error("GetHostByIPNet() IPv6 network not found:", host, found)
+		}
+	})
+	t.Run("Test invalid input", func(t *testing.T) {
+		if _, found := GetHostByIPNet("not-an-ip", 24); found {
+			t.Error("GetHostByIPNet() invalid IP found")
+		}
+		if _, found := GetHostByIPNet("151.101.1.70", 33); found {
+			t.Error("GetHostByIPNet() invalid prefix found")
+		}
+	})
+}
+
+func TestMaxHostsPerIP(t *testing.T) {
+	ip := "104.16.132.229"
+	oldMax := MaxHostsPerIP
+	MaxHostsPerIP = 3
+	defer func() { MaxHostsPerIP = oldMax }()
+
+	Track(ip, "a.example.com")
+	Track(ip, "b.example.com")
+	Track(ip, "c.example.com")
+	Track(ip, "a.example.com")
+	t.Run("Test refresh host", func(t *testing.T) {
+		hosts := Hosts(ip)
+		if len(hosts) != 3 || hosts[0] != "a.example.com" || hosts[2] != "b.example.com" {
+			t.Error("Hosts() invalid order after refreshing a host:", hosts)
+		}
+	})
+
+	Track(ip, "d.example.com")
+	t.Run("Test evict oldest host", func(t *testing.T) {
+		hosts := Hosts(ip)
+		if len(hosts) != 3 {
+			t.Error("Hosts() cap exceeded:", hosts)
+		}
+		for _, h := range hosts {
+			if h == "b.example.com" {
+				t.Error("Hosts() the least recently seen host was not evicted:", hosts)
+			}
+		}
+		if host, _ := Host(ip); host != "d.example.com" {
+			t.Error("Host() should return the most recent host:", host)
+		}
+	})
+}
+
+func TestTrackLocal(t *testing.T) {
+	skipped := GetStats().SkippedLocal
+	Track("127.0.1.1", "localhost.localdomain")
+	Track("::1", "ip6-localhost")
+	Track("fe80::1", "router.local")
+	if _, found := Host("127.0.1.1"); found {
+		t.Error("Track() loopback address tracked")
+	}
+	if _, found := Host("fe80::1"); found {
+		t.Error("Track() link-local address tracked")
+	}
+	if n := GetStats().SkippedLocal - skipped; n != 3 {
+		t.Error("Track() invalid number of skipped local addresses:", n)
+	}
+
+	SetFilter(Filter{TrackLocal: true})
+	defer SetFilter(Filter{})
+	Track("127.0.1.1", "localhost.localdomain")
+	if host, found := Host("127.0.1.1"); !found || host != "localhost.localdomain" {
+		t.Error("Track() loopback address not tracked with TrackLocal:", host, found)
+	}
+}
+
+func TestGetIPsByHost(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	Track("192.0.2.100", "multi.example.com")
+	Track("192.0.2.101", "multi.example.com")
+	Track("2001:db8::100", "Multi.Example.com")
+
+	t.Run("Test all IPs", func(t *testing.T) {
+		ips := GetIPsByHost("MULTI.example.com.")
+		if len(ips) != 3 {
+			t.Error("GetIPsByHost() invalid IPs:", ips)
+		}
+	})
+
+	ForgetIP("192.0.2.101")
+	t.Run("Test ForgetIP", func(t *testing.T) {
+		ips := GetIPsByHost("multi.example.com")
+		if len(ips) != 2 {
+			t.Error("GetIPsByHost() IP not removed from the index:", ips)
+		}
+	})
+
+	oldMax := MaxHostsPerIP
+	MaxHostsPerIP = 1
+	Track("192.0.2.100", "other.example.com")
+	MaxHostsPerIP = oldMax
+	t.Run("Test evicted host", func(t *testing.T) {
+		ips := GetIPsByHost("multi.example.com")
+		if len(ips) != 1 || ips[0] != "2001:db8::100" {
+			t.Error("GetIPsByHost() evicted host not removed from the index:", ips)
+		}
+	})
+
+	t.Run("Test unknown host", func(t *testing.T) {
+		if ips := GetIPsByHost("unknown.example.com"); len(ips) != 0 {
+			t.Error("GetIPsByHost() unknown host found:", ips)
+		}
+	})
+
+	indexLock.RLock()
+	index := make(map[string][]string)
+	for host, ips := range hostIPs {
+		for ip := range ips {
+			index[ip] = append(index[ip], host)
+		}
+	}
+	indexLock.RUnlock()
+	for ip, hosts := range index {
+		s := getShard(ip)
+		s.RLock()
+		e, found := s.entries[ip]
+		for _, host := range hosts {
+			if !found || !contains(e.hosts, host) {
+				t.Error("Reverse index inconsistent:", host, ip)
+			}
+		}
+		s.RUnlock()
+	}
+}
+
+func TestTrackEmptyHost(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	empty := GetStats().EmptyHost
+	Track("192.0.2.200", "")
+	Track("192.0.2.201", ".")
+	if _, found := Host("192.0.2.200"); found {
+		t.Error("Track() empty domain tracked")
+	}
+	if _, found := Host("192.0.2.201"); found {
+		t.Error("Track() root domain tracked")
+	}
+	if n := GetStats().EmptyHost - empty; n != 2 {
+		t.Error("Track() invalid number of empty domains:", n)
+	}
+}
+
+// newResponse returns a DNS response packet, sent by server.
+func newResponse(t *testing.T, server string, answers ...layers.DNSResourceRecord) gopacket.Packet {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(server).To4(),
+		DstIP:    net.ParseIP("192.168.1.100").To4(),
+	}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 40000}
+	udp.SetNetworkLayerForChecksum(ip)
+	dns := &layers.DNS{
+		ID:      1,
+		QR:      true,
+		ANCount: uint16(len(answers)),
+		Answers: answers,
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, dns); err != nil {
+		t.Fatal("Error serializing DNS response:", err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+}
+
+func TestTrackAnswers(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	pkt := newResponse(t, "192.168.1.1",
+		layers.DNSResourceRecord{
+			Name:  []byte("www.example.org"),
+			Type:  layers.DNSTypeCNAME,
+			Class: layers.DNSClassIN,
+			CNAME: []byte("example.org.cdn.example.net"),
+		},
+		layers.DNSResourceRecord{
+			Name:  []byte("example.org.cdn.example.net"),
+			Type:  layers.DNSTypeA,
+			Class: layers.DNSClassIN,
+			IP:    net.ParseIP("192.0.2.150").To4(),
+		},
+	)
+	if !TrackAnswers(pkt) {
+		t.Fatal("TrackAnswers() DNS response not tracked")
+	}
+
+	t.Run("Test A record", func(t *testing.T) {
+		e, found := GetEntry("192.0.2.150")
+		if !found || e.Hosts[0] != "example.org.cdn.example.net" || e.Source != "A" || e.Server != "192.168.1.1" {
+			t.Error("GetEntry() invalid A entry:", e, found)
+		}
+	})
+	t.Run("Test CNAME record", func(t *testing.T) {
+		e, found := GetEntry("example.org.cdn.example.net")
+		if !found || e.Hosts[0] != "www.example.org" || e.Source != "CNAME" {
+			t.Error("GetEntry() invalid CNAME entry:", e, found)
+		}
+	})
+	t.Run("Test HostOr", func(t *testing.T) {
+		if host := HostOr(net.ParseIP("192.0.2.150"), ""); host != "www.example.org" {
+			t.Error("HostOr() invalid root domain:", host)
+		}
+	})
+}
+
+func TestTrackAnswersSRV(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	pkt := newResponse(t, "192.168.1.1",
+		layers.DNSResourceRecord{
+			Name:  []byte("_xmpp-client._tcp.example.org"),
+			Type:  layers.DNSTypeSRV,
+			Class: layers.DNSClassIN,
+			SRV:   layers.DNSSRV{Priority: 5, Weight: 0, Port: 5222, Name: []byte("xmpp.example.org")},
+		},
+	)
+	TrackAnswers(pkt)
+	Track("192.0.2.160", "xmpp.example.org")
+
+	if e, found := GetEntry("xmpp.example.org"); !found || e.Hosts[0] != "_xmpp-client._tcp.example.org" || e.Source != "SRV" {
+		t.Error("GetEntry() invalid SRV entry:", e, found)
+	}
+	if host := HostOr(net.ParseIP("192.0.2.160"), ""); host != "xmpp.example.org" {
+		t.Error("HostOr() SRV target should not be followed:", host)
+	}
+}
+
+func TestTrackAnswersCompressedMX(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	payload := []byte{
+		// header: id, flags (response), 1 question, 1 answer, 0 ns, 1 additional
+		0x00, 0x01, 0x81, 0x80, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+		// question: example.com MX IN
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0x00, 0x0f, 0x00, 0x01,
+		// answer: name pointer to the question, MX, IN, TTL, rdlength 9, preference 10,
+		// exchange: mail + pointer to example.com
+		0xc0, 0x0c, 0x00, 0x0f, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x09,
+		0x00, 0x0a, 4, 'm', 'a', 'i', 'l', 0xc0, 0x0c,
+		// additional: pointer to mail.example.com, A, IN, TTL, rdlength 4, 192.0.2.170
+		0xc0, 0x2b, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x04,
+		192, 0, 2, 170,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("192.168.1.1").To4(),
+		DstIP:    net.ParseIP("192.168.1.100").To4(),
+	}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 40001}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal("Error serializing DNS response:", err)
+	}
+	TrackAnswers(gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default))
+
+	if e, found := GetEntry("mail.example.com"); !found || e.Hosts[0] != "example.com" || e.Source != "MX" {
+		t.Error("GetEntry() invalid MX entry:", e, found)
+	}
+	if host, found := Host("192.0.2.170"); !found || host != "mail.example.com" {
+		t.Error("Host() MX target additional record not tracked:", host, found)
+	}
+}
+
+func TestTrackResult(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	ip := "192.0.2.210"
+	if r := Track(ip, "first.example.com"); r != TrackNew {
+		t.Error("Track() new record, unexpected result:", r)
+	}
+	if r := Track(ip, "first.example.com"); r != TrackRefreshed {
+		t.Error("Track() refreshed record, unexpected result:", r)
+	}
+	if r := Track(ip, "second.example.com"); r != TrackChanged {
+		t.Error("Track() changed record, unexpected result:", r)
+	}
+	if r := Track(ip, ""); r != TrackSkipped {
+		t.Error("Track() skipped record, unexpected result:", r)
+	}
+
+	setLastSeen(ip, time.Now().Add(-MaxEntryAge-time.Second))
+	if r := Track(ip, "second.example.com"); r != TrackNew {
+		t.Error("Track() expired record, unexpected result:", r)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	Track("192.0.2.220", "snapshot.example.com")
+	snapshot := Snapshot()
+	e, found := snapshot["192.0.2.220"]
+	if !found || e.Hosts[0] != "snapshot.example.com" {
+		t.Error("Snapshot() tracked IP not found:", e, found)
+	}
+
+	// the snapshot must not be modified by the tracker
+	Track("192.0.2.220", "other.example.com")
+	if snapshot["192.0.2.220"].Hosts[0] != "snapshot.example.com" {
+		t.Error("Snapshot() modified after tracking:", snapshot["192.0.2.220"])
+	}
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			Track("192.0.2.221", fmt.Sprint("host", i, ".example.com"))
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		Snapshot()
+	}
+	<-done
+
+	t.Run("Test point in time", func(t *testing.T) {
+		// the first IP is always tracked before the second one, so a
+		// snapshot can't have the second one tracked more times.
+		ForgetIP("192.0.2.222")
+		ForgetIP("192.0.2.223")
+		go func() {
+			for i := 0; i < 2000; i++ {
+				Track("192.0.2.222", "first.snapshot.example.com")
+				Track("192.0.2.223", "second.snapshot.example.com")
+			}
+			done <- true
+		}()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			snapshot := Snapshot()
+			if first, second := snapshot["192.0.2.222"], snapshot["192.0.2.223"]; second.Resolved > first.Resolved {
+				t.Fatal("Snapshot() not a point in time copy:", first.Resolved, second.Resolved)
+			}
+		}
+	})
+}
+
+func TestPauseResume(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	answer := layers.DNSResourceRecord{
+		Name:  []byte("paused.example.com"),
+		Type:  layers.DNSTypeA,
+		Class: layers.DNSClassIN,
+		IP:    net.ParseIP("192.0.2.245").To4(),
+	}
+	discarded := GetStats().DiscardedPaused
+
+	Pause()
+	if !Paused() || !GetStats().Paused {
+		t.Error("Pause() paused state not reported")
+	}
+	if !TrackAnswers(newResponse(t, "192.168.1.1", answer)) {
+		t.Error("TrackAnswers() DNS response not recognized while paused")
+	}
+	if _, found := Host("192.0.2.245"); found {
+		t.Error("TrackAnswers() DNS response tracked while paused")
+	}
+	if GetStats().DiscardedPaused != discarded+1 {
+		t.Error("TrackAnswers() discarded response not counted")
+	}
+
+	Resume()
+	TrackAnswers(newResponse(t, "192.168.1.1", answer))
+	if _, found := Host("192.0.2.245"); !found {
+		t.Error("TrackAnswers() DNS response not tracked after resuming")
+	}
+}
+
+func TestPauseInFlight(t *testing.T) {
+	host := "inflight.pause.example.com"
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				TrackAnswers(newResponse(t, "192.168.1.1", layers.DNSResourceRecord{
+					Name:  []byte(host),
+					Type:  layers.DNSTypeA,
+					Class: layers.DNSClassIN,
+					IP:    net.IPv4(198, 18, byte(w), byte(i)),
+				}))
+			}
+		}(w)
+	}
+	defer func() {
+		close(stop)
+		wg.Wait()
+		Resume()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	Pause()
+	tracked := len(GetIPsByHost(host))
+	time.Sleep(20 * time.Millisecond)
+	if n := len(GetIPsByHost(host)); n != tracked {
+		t.Error("TrackAnswers() responses tracked after Pause() returned:", n-tracked)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	ip := "192.0.2.235"
+	Track(ip, "popular.example.com")
+	Track(ip, "popular.example.com")
+	Track(ip, "alias.popular.example.com")
+	CountConnection(ip)
+	CountConnection("192.0.2.236")
+
+	e, found := GetEntry(ip)
+	if !found || e.Resolved != 3 || e.Connections != 1 {
+		t.Error("GetEntry() invalid counters:", e, found)
+	}
+}
+
+// The daemon supports go < 1.18, so instead of a native fuzz target, feed
+// truncated and random DNS payloads to the decoding path.
+func TestTrackAnswersMalformed(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	valid := newResponse(t, "192.168.1.1",
+		layers.DNSResourceRecord{
+			Name:  []byte("www.example.org"),
+			Type:  layers.DNSTypeCNAME,
+			Class: layers.DNSClassIN,
+			CNAME: []byte("example.org.cdn.example.net"),
+		},
+		layers.DNSResourceRecord{
+			Name:  []byte("example.org.cdn.example.net"),
+			Type:  layers.DNSTypeAAAA,
+			Class: layers.DNSClassIN,
+			IP:    net.ParseIP("2001:db8::150"),
+		},
+	)
+	// ipv4 (20) + udp (8) headers
+	payload := valid.Data()[28:]
+
+	payloads := [][]byte{nil, {0}, make([]byte, 12), make([]byte, 512)}
+	for i := 1; i < len(payload); i++ {
+		payloads = append(payloads, payload[:i])
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		p := make([]byte, len(payload))
+		copy(p, payload)
+		for n := rnd.Intn(8); n >= 0; n-- {
+			p[rnd.Intn(len(p))] = byte(rnd.Intn(256))
+		}
+		payloads = append(payloads, p[:rnd.Intn(len(p)+1)])
+	}
+
+	for _, p := range payloads {
+		ip := &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    net.ParseIP("192.168.1.1").To4(),
+			DstIP:    net.ParseIP("192.168.1.100").To4(),
+		}
+		udp := &layers.UDP{SrcPort: 53, DstPort: 40002}
+		udp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(p)); err != nil {
+			t.Fatal("Error serializing DNS response:", err)
+		}
+		// must not panic
+		TrackAnswers(gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default))
+	}
+}
+
+func TestPreferForward(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	ptr := layers.DNSTypePTR.String()
+
+	t.Run("only reverse", func(t *testing.T) {
+		TrackFrom("198.51.100.70", "ptr.trust.example.com", nil, ptr)
+		if h, low, _ := HostTrust("198.51.100.70"); h != "ptr.trust.example.com" || !low {
+			t.Error("HostTrust() reverse domain not flagged:", h, low)
+		}
+		if e, _ := GetEntry("198.51.100.70"); !e.LowTrust {
+			t.Error("GetEntry() reverse domain not flagged:", e)
+		}
+	})
+	t.Run("forward and reverse", func(t *testing.T) {
+		TrackFrom("198.51.100.71", "fwd.trust.example.com", nil, "A")
+		TrackFrom("198.51.100.71", "spoofed.trust.example.com", nil, ptr)
+		if h, low, _ := HostTrust("198.51.100.71"); h != "fwd.trust.example.com" || low {
+			t.Error("HostTrust() forward domain not preferred:", h, low)
+		}
+		if hosts := Hosts("198.51.100.71"); hosts[0] != "fwd.trust.example.com" || hosts[1] != "spoofed.trust.example.com" {
+			t.Error("Hosts() forward domain not first:", hosts)
+		}
+		if h := HostOr(net.ParseIP("198.51.100.71"), ""); h != "fwd.trust.example.com" {
+			t.Error("HostOr() forward domain not preferred:", h)
+		}
+	})
+	t.Run("reverse confirmed by forward", func(t *testing.T) {
+		TrackFrom("198.51.100.72", "both.trust.example.com", nil, ptr)
+		TrackFrom("198.51.100.72", "both.trust.example.com", nil, "A")
+		TrackFrom("198.51.100.72", "both.trust.example.com", nil, ptr)
+		if h, low, _ := HostTrust("198.51.100.72"); h != "both.trust.example.com" || low {
+			t.Error("HostTrust() forward domain flagged:", h, low)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		PreferForward = false
+		defer func() { PreferForward = true }()
+		if h, _ := Host("198.51.100.71"); h != "spoofed.trust.example.com" {
+			t.Error("Host() most recent domain not returned:", h)
+		}
+	})
+}
+
+func TestRecentResponses(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	defer SetRecentSize(DefaultRecentSize)
+	SetRecentSize(2)
+
+	for i := 0; i < 3; i++ {
+		TrackAnswers(newResponse(t, "192.168.1.1", layers.DNSResourceRecord{
+			Name:  []byte(fmt.Sprint(i, ".recent.example.com")),
+			Type:  layers.DNSTypeA,
+			Class: layers.DNSClassIN,
+			IP:    net.ParseIP(fmt.Sprint("198.51.100.", 80+i)),
+		}))
+	}
+	list := RecentResponses()
+	if len(list) != 2 {
+		t.Fatal("RecentResponses() unexpected length:", len(list))
+	}
+	if r := list[0].Records; len(r) != 1 || r[0].Name != "1.recent.example.com" || r[0].Value != "198.51.100.81" || r[0].Result != "new" {
+		t.Error("RecentResponses() unexpected oldest record:", r)
+	}
+	if list[1].Records[0].Name != "2.recent.example.com" || list[1].Server != "192.168.1.1" || len(list[1].Raw) == 0 {
+		t.Error("RecentResponses() unexpected newest response:", list[1])
+	}
+
+	SetRecentSize(0)
+	TrackAnswers(newResponse(t, "192.168.1.1"))
+	if list := RecentResponses(); len(list) != 0 {
+		t.Error("RecentResponses() disabled, but not empty:", list)
+	}
+}
+
+func TestNames(t *testing.T) {
+	SetFilter(Filter{Skip: testSkip})
+	defer SetFilter(Filter{})
+	Track("example.map.cdn.example.net", "cdn.names.example.com")
+	Track("198.51.100.90", "example.map.cdn.example.net")
+	Track("198.51.100.91", "example.map.cdn.example.net")
+
+	queried, canonical, found := Names("198.51.100.90")
+	if !found || queried != "cdn.names.example.com" || canonical != "example.map.cdn.example.net" {
+		t.Error("Names() unexpected domains:", queried, canonical, found)
+	}
+	if h := HostOr(net.ParseIP("198.51.100.90"), ""); h != "cdn.names.example.com" {
+		t.Error("HostOr() queried domain not returned:", h)
+	}
+	MatchQueried = false
+	if h := HostOr(net.ParseIP("198.51.100.90"), ""); h != "example.map.cdn.example.net" {
+		t.Error("HostOr() canonical domain not returned:", h)
+	}
+	MatchQueried = true
+
+	for _, host := range []string{"cdn.names.example.com", "example.map.cdn.example.net"} {
+		if ips := GetIPsByHost(host); len(ips) != 2 {
+			t.Error("GetIPsByHost() unexpected IPs:", host, ips)
+		}
+	}
+}
+
+// benchmarkConcurrent tracks and looks up IPs concurrently, 1 track every 4
+// lookups, with the list split in the given number of shards.
+func benchmarkConcurrent(b *testing.B, n int) {
+	old := shards
+	shards = newShards(n)
+	defer func() { shards = old }()
+
+	ips := make([]string, 1024)
+	for i := range ips {
+		ips[i] = fmt.Sprint("198.19.", i/256, ".", i%256)
+		Track(ips[i], "bench.example.com")
+	}
+	var worker int32
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt32(&worker, 1)) * 97
+		for pb.Next() {
+			ip := ips[i%len(ips)]
+			if i%4 == 0 {
+				Track(ip, "bench.example.com")
+			} else {
+				Host(ip)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkConcurrentSingleLock(b *testing.B) {
+	benchmarkConcurrent(b, 1)
+}
+
+func BenchmarkConcurrentSharded(b *testing.B) {
+	benchmarkConcurrent(b, numShards)
+}
@@ -11,6 +11,7 @@ import (
 	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"strings"
 	"syscall"
 	"time"
 
@@ -36,6 +37,21 @@ var (
 	queueNum       = 0
 	repeatQueueNum int //will be set later to queueNum + 1
 	workers        = 16
+	dnsCacheTTL    = dns.MaxEntryAge
+	dnsCacheClean  = 10 * time.Minute
+	dnsMaxHosts    = dns.MaxHostsPerIP
+	dnsSocket      = ""
+	dnsTrackLocal  = false
+	dnsSkipScopes  = strings.Join(dns.DefaultSkip, ",")
+	dnsBootstrap   = false
+	dnsPreferFwd   = dns.PreferForward
+	dnsRecent      = dns.DefaultRecentSize
+	dnsCanonical   = !dns.MatchQueried
+	dnsPinGrace    = dns.PinGracePeriod
+	dnsLazy        = false
+	dnsAuditFile   = ""
+	dnsAuditSize   = int64(0)
+	dnsAuditSync   = false
 	debug          = false
 	warning        = false
 	important      = false
@@ -69,6 +85,21 @@ func init() {
 	flag.IntVar(&queueNum, "queue-num", queueNum, "Netfilter queue number.")
 	flag.IntVar(&workers, "workers", workers, "Number of concurrent workers.")
 	flag.BoolVar(&noLiveReload, "no-live-reload", debug, "Disable rules live reloading.")
+	flag.DurationVar(&dnsCacheTTL, "dns-cache-ttl", dnsCacheTTL, "Time to keep a resolved domain in cache since it was last seen.")
+	flag.DurationVar(&dnsCacheClean, "dns-cache-cleanup-interval", dnsCacheClean, "Interval to remove expired domains from the cache, 0 to disable it.")
+	flag.StringVar(&dnsSocket, "dns-events-socket", dnsSocket, "Stream the resolved domains as JSON lines on this Unix socket path.")
+	flag.BoolVar(&dnsTrackLocal, "dns-track-local", dnsTrackLocal, "Track domains resolved to loopback and link-local addresses.")
+	flag.StringVar(&dnsSkipScopes, "dns-skip-scopes", dnsSkipScopes, "Comma separated scopes of the addresses not to track: loopback, link-local, ula, multicast, documentation or none.")
+	flag.BoolVar(&dnsBootstrap, "dns-bootstrap", dnsBootstrap, "Resolve the domains of the connections established before the daemon started.")
+	flag.BoolVar(&dnsPreferFwd, "dns-prefer-forward", dnsPreferFwd, "Prefer the domains of forward lookups over the ones obtained with reverse (PTR) lookups.")
+	flag.BoolVar(&dnsCanonical, "dns-match-canonical", dnsCanonical, "Match the rules against the canonical name of the domains (CNAME) instead of the queried one.")
+	flag.DurationVar(&dnsPinGrace, "dns-pin-grace-period", dnsPinGrace, "Time to keep an expired domain in cache while a rule references it, 0 to disable it.")
+	flag.BoolVar(&dnsLazy, "dns-lazy", dnsLazy, "Resolve the domains only for the connections being evaluated, instead of tracking every DNS response.")
+	flag.IntVar(&dnsRecent, "dns-recent-responses", dnsRecent, "Number of recent DNS responses to keep for debugging, 0 to disable it.")
+	flag.StringVar(&dnsAuditFile, "dns-audit-file", dnsAuditFile, "Append the resolved domains to this audit file, one JSON object per line.")
+	flag.Int64Var(&dnsAuditSize, "dns-audit-max-size", dnsAuditSize, "Size in bytes after which the DNS audit file is rotated, 0 to never rotate it.")
+	flag.BoolVar(&dnsAuditSync, "dns-audit-sync", dnsAuditSync, "Flush every DNS audit record to disk.")
+	flag.IntVar(&dnsMaxHosts, "dns-max-hosts-per-ip", dnsMaxHosts, "Maximum number of domains to keep in cache for an IP.")
 
 	flag.StringVar(&logFile, "log-file", logFile, "Write logs to this file instead of the standard output.")
 	flag.BoolVar(&debug, "debug", debug, "Enable debug level logs.")
@@ -362,6 +393,46 @@ func main() {
 	}
 	stats = statistics.New(rules)
 
+	dns.MaxEntryAge = dnsCacheTTL
+	dns.MaxHostsPerIP = dnsMaxHosts
+	dns.PreferForward = dnsPreferFwd
+	dns.SetRecentSize(dnsRecent)
+	dns.MatchQueried = !dnsCanonical
+	dns.SetLazy(dnsLazy)
+	if err := dns.SetDefaultFilter(dns.Filter{TrackLocal: dnsTrackLocal, Skip: strings.Split(dnsSkipScopes, ",")}); err != nil {
+		log.Fatal("%s", err)
+	}
+	if dnsPinGrace > 0 {
+		dns.PinGracePeriod = dnsPinGrace
+		dns.SetPinCheck(func(ip string, hosts []string) bool {
+			for _, host := range hosts {
+				if rules.ReferencesHost(host) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if dnsBootstrap {
+		go dns.Bootstrap(ctx, 100*time.Millisecond)
+	}
+	go dns.CacheCleanerTask(ctx, dnsCacheClean)
+	if err := dns.LoadHostsFile(ctx, dns.HostsFile); err != nil {
+		log.Warning("Unable to load hosts file %s: %s", dns.HostsFile, err)
+	}
+	if dnsSocket != "" {
+		if err := dns.StreamEvents(ctx, dnsSocket, 0600); err != nil {
+			log.Warning("Unable to stream DNS records on %s: %s", dnsSocket, err)
+		}
+	}
+
+	if dnsAuditFile != "" {
+		opts := dns.AuditOptions{Path: dnsAuditFile, MaxSize: dnsAuditSize, Sync: dnsAuditSync}
+		if err := dns.Audit(ctx, opts, 1024); err != nil {
+			log.Warning("Unable to write DNS audit records to %s: %s", dnsAuditFile, err)
+		}
+	}
+
 	// prepare the queue
 	setupWorkers()
 	queue, err := netfilter.NewQueue(uint16(queueNum))
@@ -416,3 +416,16 @@ func (l *Loader) FindFirstMatch(con *conman.Connection) (match *Rule) {
 
 	return match
 }
+
+// ReferencesHost checks if any of the enabled rules matches a domain.
+func (l *Loader) ReferencesHost(host string) bool {
+	l.RLock()
+	defer l.RUnlock()
+
+	for _, rule := range l.rules {
+		if rule.Enabled && rule.Operator.matchHost(host) {
+			return true
+		}
+	}
+	return false
+}
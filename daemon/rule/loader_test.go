@@ -163,6 +163,34 @@ func Copy(src, dst string) error {
 	return out.Close()
 }
 
+func TestRuleLoaderReferencesHost(t *testing.T) {
+	t.Parallel()
+	t.Log("Test rules loader: ReferencesHost()")
+
+	var list []Operator
+	hostOper, _ := NewOperator(Simple, false, OpDstHost, "www.example.com", list)
+	hostOper.Compile()
+	disabledOper, _ := NewOperator(Regexp, false, OpDstHost, "^disabled\\.", list)
+	disabledOper.Compile()
+
+	l, err := NewLoader(false)
+	if err != nil {
+		t.Fail()
+	}
+	l.Add(Create("000-host-rule", true, false, Allow, Always, hostOper), false)
+	l.Add(Create("001-disabled-rule", false, false, Allow, Always, disabledOper), false)
+
+	if !l.ReferencesHost("www.example.com") {
+		t.Error("ReferencesHost() domain of a rule not found")
+	}
+	if l.ReferencesHost("disabled.example.com") {
+		t.Error("ReferencesHost() domain of a disabled rule found")
+	}
+	if l.ReferencesHost("other.example.com") {
+		t.Error("ReferencesHost() unknown domain found")
+	}
+}
+
 func testNumRules(t *testing.T, l *Loader, num int) {
 	if l.NumRules() != num {
 		t.Error("rules number should be (2): ", num)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/evilsocket/opensnitch/daemon/conman"
 	"github.com/evilsocket/opensnitch/daemon/core"
+	"github.com/evilsocket/opensnitch/daemon/dns"
 	"github.com/evilsocket/opensnitch/daemon/log"
 )
 
@@ -67,6 +68,7 @@ type Operator struct {
 	sync.RWMutex
 	cb                  opCallback
 	re                  *regexp.Regexp
+	host                string
 	netMask             *net.IPNet
 	isCompiled          bool
 	lists               map[string]interface{}
@@ -93,6 +95,12 @@ func (o *Operator) Compile() error {
 	}
 	if o.Type == Simple {
 		o.cb = o.simpleCmp
+		if o.Operand == OpDstHost {
+			// tracked domains are normalized, so we need to compare them in
+			// the same form, even if the rule is case-sensitive, since
+			// domains are not: Müller.example -> xn--mller-kva.example
+			o.host = dns.NormalizeHost(o.Data)
+		}
 	} else if o.Type == Regexp {
 		o.cb = o.reCmp
 		if o.Sensitive == false {
@@ -152,6 +160,9 @@ func (o *Operator) String() string {
 }
 
 func (o *Operator) simpleCmp(v interface{}) bool {
+	if o.Operand == OpDstHost {
+		return v == o.host
+	}
 	if o.Sensitive == false {
 		return strings.EqualFold(v.(string), o.Data)
 	}
@@ -166,9 +177,25 @@ func (o *Operator) reCmp(v interface{}) bool {
 	if o.Sensitive == false {
 		v = strings.ToLower(v.(string))
 	}
+	if o.Operand == OpDstHost {
+		return matchHostForms(o.re, v.(string))
+	}
 	return o.re.MatchString(v.(string))
 }
 
+// matchHostForms matches a normalized domain against a regexp, and also its
+// unicode form if it's an internationalized domain, since the regexps can't
+// be normalized: ^müller\. matches xn--mller-kva.example
+func matchHostForms(re *regexp.Regexp, host string) bool {
+	if re.MatchString(host) {
+		return true
+	}
+	if u := dns.UnicodeHost(host); u != host {
+		return re.MatchString(u)
+	}
+	return false
+}
+
 func (o *Operator) cmpNetwork(destIP interface{}) bool {
 	// 192.0.2.1/24, 2001:db8:a0b:12f0::1/32
 	if o.netMask == nil {
@@ -235,7 +262,7 @@ func (o *Operator) reListCmp(v interface{}) bool {
 	}
 	for file, re := range o.lists {
 		r := re.(*regexp.Regexp)
-		if r.MatchString(dstHost) {
+		if matchHostForms(r, dstHost) {
 			log.Debug("%s: %s, %s", log.Red("Regexp list match"), dstHost, file)
 			return true
 		}
@@ -292,3 +319,19 @@ func (o *Operator) Match(con *conman.Connection) bool {
 
 	return false
 }
+
+// matchHost checks if the operator, or any of the operators of a list,
+// matches a domain.
+func (o *Operator) matchHost(host string) bool {
+	switch o.Operand {
+	case OpList:
+		for i := 0; i < len(o.List); i++ {
+			if o.List[i].matchHost(host) {
+				return true
+			}
+		}
+	case OpDstHost, OpDomainsLists, OpDomainsRegexpLists:
+		return o.cb != nil && o.cb(host)
+	}
+	return false
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/evilsocket/opensnitch/daemon/core"
+	"github.com/evilsocket/opensnitch/daemon/dns"
 	"github.com/evilsocket/opensnitch/daemon/log"
 )
 
@@ -124,7 +125,7 @@ func (o *Operator) readDomainsList(raw, fileName string) (dups uint64) {
 			continue
 		}
 
-		host = core.Trim(host)
+		host = dns.NormalizeHost(core.Trim(host))
 		if _, found := o.lists[host]; found {
 			dups++
 			continue
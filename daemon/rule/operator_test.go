@@ -162,13 +162,45 @@ func TestNewOperatorSimple(t *testing.T) {
 			t.Error("NewOperator simple.dstHost.sensitive Compile() err:", err)
 			t.Fail()
 		}
-		conn.DstHost = "OpEnsNitCh.io"
+		// domains are normalized when they're tracked.
+		conn.DstHost = "opensnitch.io"
 		if opSimple.Match(conn) == false {
 			t.Error("Test NewOperator() simple.dstHost.sensitive doesn't match")
 			t.Fail()
 		}
 	})
 
+	t.Run("Operator Simple con.dstHost IDN", func(t *testing.T) {
+		opSimple, err = NewOperator(Simple, false, OpDstHost, "Müller.example", list)
+		if err != nil {
+			t.Error("NewOperator simple.dstHost.idn err should be nil: ", err)
+			t.Fail()
+		}
+		if err = opSimple.Compile(); err != nil {
+			t.Error("NewOperator simple.dstHost.idn Compile() err:", err)
+			t.Fail()
+		}
+		conn.DstHost = "xn--mller-kva.example"
+		if opSimple.Match(conn) == false {
+			t.Error("Test NewOperator() simple.dstHost.idn doesn't match")
+			t.Fail()
+		}
+
+		opSimple, err = NewOperator(Simple, true, OpDstHost, "Müller.example", list)
+		if err != nil {
+			t.Error("NewOperator simple.dstHost.idn.sensitive err should be nil: ", err)
+		}
+		if err = opSimple.Compile(); err != nil {
+			t.Error("NewOperator simple.dstHost.idn.sensitive Compile() err:", err)
+		}
+		if opSimple.Match(conn) == false {
+			t.Error("Test NewOperator() simple.dstHost.idn.sensitive doesn't match")
+		}
+		if opSimple.Data != "Müller.example" {
+			t.Error("Test NewOperator() simple.dstHost.idn data modified:", opSimple.Data)
+		}
+	})
+
 	t.Run("Operator Simple proc.args case-insensitive", func(t *testing.T) {
 		// proc args case-insensitive
 		opSimple, err = NewOperator(Simple, false, OpProcessCmd, defaultProcArgs, list)
@@ -276,6 +308,31 @@ func TestNewOperatorRegexp(t *testing.T) {
 	restoreConnection()
 }
 
+func TestNewOperatorRegexpIDN(t *testing.T) {
+	t.Log("Test NewOperator() regexp IDN")
+	var dummyList []Operator
+
+	for _, sensitive := range []Sensitive{false, true} {
+		opRE, err := NewOperator(Regexp, sensitive, OpDstHost, `^müller\.`, dummyList)
+		if err != nil {
+			t.Error("NewOperator regexp.dstHost.idn err should be nil: ", err)
+		}
+		if err = opRE.Compile(); err != nil {
+			t.Error("NewOperator regexp.dstHost.idn Compile() err:", err)
+		}
+		conn.DstHost = "xn--mller-kva.example"
+		if opRE.Match(conn) == false {
+			t.Error("Test NewOperator() regexp.dstHost.idn doesn't match:", sensitive)
+		}
+		conn.DstHost = "mueller.example"
+		if opRE.Match(conn) == true {
+			t.Error("Test NewOperator() regexp.dstHost.idn match:", sensitive)
+		}
+	}
+
+	restoreConnection()
+}
+
 func TestNewOperatorInvalidRegexp(t *testing.T) {
 	t.Log("Test NewOperator() invalid regexp")
 	var dummyList []Operator
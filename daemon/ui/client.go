@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/evilsocket/opensnitch/daemon/conman"
+	"github.com/evilsocket/opensnitch/daemon/dns"
 	"github.com/evilsocket/opensnitch/daemon/firewall/iptables"
 	"github.com/evilsocket/opensnitch/daemon/log"
 	"github.com/evilsocket/opensnitch/daemon/rule"
@@ -46,6 +47,7 @@ type Config struct {
 	LogLevel          *uint32                `json:"LogLevel"`
 	Firewall          string                 `json:"Firewall"`
 	Stats             statistics.StatsConfig `json:"Stats"`
+	DNS               *dns.Config            `json:"DNS"`
 }
 
 // Client holds the connection information of a client.
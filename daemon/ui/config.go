@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"strings"
 
+	"github.com/evilsocket/opensnitch/daemon/dns"
 	"github.com/evilsocket/opensnitch/daemon/log"
 	"github.com/evilsocket/opensnitch/daemon/procmon/monitor"
 	"github.com/evilsocket/opensnitch/daemon/rule"
@@ -101,6 +102,18 @@ func (c *Client) loadConfiguration(rawConfig []byte) bool {
 			log.Warning("Unable to set new process monitor method from disk: %v", err)
 		}
 	}
+	if config.DNS != nil {
+		if err := dns.SetFilter(config.DNS.Filter); err != nil {
+			log.Error("Error loading DNS filter, keeping the current one: %s", err)
+		}
+		if err := dns.SetStatic(config.DNS.Static); err != nil {
+			log.Error("Error loading DNS static domains, keeping the current ones: %s", err)
+		}
+	} else {
+		// the section may have been removed.
+		dns.SetFilter(dns.GetDefaultFilter())
+		dns.SetStatic(nil)
+	}
 
 	return true
 }